@@ -0,0 +1,232 @@
+// Package cache implements the cache-aside pattern on Redis:
+//
+//	client, _ := gorote.NewRedis(url)
+//	cache.SetDefault(cache.New(client, cache.Options{Prefix: "app:", LocalSize: 1000}))
+//
+//	user, err := cache.GetOrLoad(ctx, "user:"+id, time.Hour, func(ctx context.Context) (User, error) {
+//		return repo.FindUser(ctx, id)
+//	})
+//
+// Concurrent misses for the same key run the loader once, loaders may return
+// ErrNotFound to cache the absence of a value, TTLs are jittered so keys
+// written together do not expire together, and an optional in-process LRU
+// serves hot keys without a round trip.
+package cache
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrNotFound is returned by loaders when the value does not exist. It is
+	// cached for Options.NegativeTTL and returned to every caller meanwhile.
+	ErrNotFound = errors.New("cache: not found")
+	// ErrNoDefault is returned by GetOrLoad before SetDefault is called.
+	ErrNoDefault = errors.New("cache: default cache not set")
+)
+
+// Stored values are prefixed with a marker so absences can be cached too.
+const (
+	markValue    byte = 'v'
+	markNotFound byte = 'n'
+)
+
+type Options struct {
+	// Prefix is prepended to every Redis key.
+	Prefix string
+	// Codec defaults to JSON.
+	Codec Codec
+	// NegativeTTL is how long ErrNotFound from a loader is cached. Zero
+	// disables negative caching.
+	NegativeTTL time.Duration
+	// Jitter randomly shortens TTLs by up to this fraction. Defaults to 0.1;
+	// a negative value disables it.
+	Jitter float64
+	// LocalSize is the capacity of the in-process LRU. Zero disables it.
+	LocalSize int
+	// LocalTTL bounds how long a replica serves a key from its LRU after
+	// another replica changed it. Defaults to ten seconds.
+	LocalTTL time.Duration
+	// LoadTimeout bounds the shared call that reads Redis and runs the
+	// loader, so a hung loader does not block the key for later callers.
+	// Defaults to thirty seconds.
+	LoadTimeout time.Duration
+}
+
+type Cache struct {
+	Redis *redis.Client
+	opts  Options
+	group singleflight.Group
+	local *lru
+}
+
+func New(client *redis.Client, opts Options) *Cache {
+	if opts.Codec == nil {
+		opts.Codec = JSON
+	}
+	if opts.Jitter == 0 {
+		opts.Jitter = 0.1
+	}
+	if opts.LocalTTL <= 0 {
+		opts.LocalTTL = 10 * time.Second
+	}
+	if opts.LoadTimeout <= 0 {
+		opts.LoadTimeout = 30 * time.Second
+	}
+	c := &Cache{Redis: client, opts: opts}
+	if opts.LocalSize > 0 {
+		c.local = newLRU(opts.LocalSize)
+	}
+	return c
+}
+
+var defaultCache atomic.Pointer[Cache]
+
+// SetDefault sets the cache used by GetOrLoad.
+func SetDefault(c *Cache) {
+	defaultCache.Store(c)
+}
+
+func Default() *Cache {
+	return defaultCache.Load()
+}
+
+// GetOrLoad returns the value under key from the default cache, calling
+// loader and storing its result for ttl on a miss.
+func GetOrLoad[T any](ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	c := defaultCache.Load()
+	if c == nil {
+		var zero T
+		return zero, ErrNoDefault
+	}
+	return GetOrLoadFrom(ctx, c, key, ttl, loader)
+}
+
+// GetOrLoadFrom is GetOrLoad on a specific cache.
+func GetOrLoadFrom[T any](ctx context.Context, c *Cache, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	data, err := c.load(ctx, key, ttl, func(ctx context.Context) ([]byte, error) {
+		v, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.opts.Codec.Marshal(v)
+	})
+	if err != nil {
+		return value, err
+	}
+	if err := c.opts.Codec.Unmarshal(data, &value); err != nil {
+		return value, err
+	}
+	return value, nil
+}
+
+// Set stores v under key for ttl, replacing any cached value.
+func (c *Cache) Set(ctx context.Context, key string, v any, ttl time.Duration) error {
+	data, err := c.opts.Codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	raw := append([]byte{markValue}, data...)
+	key = c.opts.Prefix + key
+	if err := c.Redis.Set(ctx, key, raw, c.jitter(ttl)).Err(); err != nil {
+		return err
+	}
+	c.remember(key, raw, ttl)
+	return nil
+}
+
+// Delete removes keys from Redis and from the local LRU. Other replicas may
+// still serve them from their LRU for up to Options.LocalTTL.
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = c.opts.Prefix + key
+		if c.local != nil {
+			c.local.delete(full[i])
+		}
+	}
+	return c.Redis.Del(ctx, full...).Err()
+}
+
+// load returns the encoded value under key, calling fill once per key across
+// concurrent misses.
+func (c *Cache) load(ctx context.Context, key string, ttl time.Duration, fill func(context.Context) ([]byte, error)) ([]byte, error) {
+	key = c.opts.Prefix + key
+	if c.local != nil {
+		if raw, ok := c.local.get(key); ok {
+			return decode(raw)
+		}
+	}
+
+	// The shared call must outlive the caller that started it, since the
+	// others wait for its result, but not a hung loader.
+	ch := c.group.DoChan(key, func() (any, error) {
+		shared, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.opts.LoadTimeout)
+		defer cancel()
+		raw, err := c.Redis.Get(shared, key).Bytes()
+		if err == nil && len(raw) > 0 {
+			c.remember(key, raw, ttl)
+			return raw, nil
+		}
+		// On Redis errors the loader still serves the request.
+		redisUp := err == nil || errors.Is(err, redis.Nil)
+
+		data, err := fill(shared)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			if c.opts.NegativeTTL <= 0 {
+				return nil, err
+			}
+			raw = []byte{markNotFound}
+			ttl = c.opts.NegativeTTL
+		case err != nil:
+			return nil, err
+		default:
+			raw = append([]byte{markValue}, data...)
+		}
+		if redisUp {
+			// A failed write only costs another load later.
+			c.Redis.Set(shared, key, raw, c.jitter(ttl))
+		}
+		c.remember(key, raw, ttl)
+		return raw, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return decode(res.Val.([]byte))
+	}
+}
+
+func decode(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || raw[0] == markNotFound {
+		return nil, ErrNotFound
+	}
+	return raw[1:], nil
+}
+
+func (c *Cache) remember(key string, raw []byte, ttl time.Duration) {
+	if c.local != nil {
+		c.local.set(key, raw, min(ttl, c.opts.LocalTTL))
+	}
+}
+
+func (c *Cache) jitter(ttl time.Duration) time.Duration {
+	if c.opts.Jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	return ttl - time.Duration(rand.Float64()*c.opts.Jitter*float64(ttl))
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+type user struct {
+	ID   string
+	Name string
+}
+
+func TestGetOrLoad(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	if _, err := GetOrLoad(ctx, "x", time.Minute, func(context.Context) (int, error) { return 1, nil }); !errors.Is(err, ErrNoDefault) {
+		t.Errorf("esperava ErrNoDefault, recebeu %v", err)
+	}
+	SetDefault(New(client, Options{Prefix: "app:", Codec: MsgPack, NegativeTTL: time.Minute, LocalSize: 10}))
+	t.Cleanup(func() { SetDefault(nil) })
+
+	t.Run("singleflight carrega uma vez", func(t *testing.T) {
+		var calls atomic.Int32
+		release := make(chan struct{})
+		loader := func(context.Context) (user, error) {
+			calls.Add(1)
+			<-release
+			return user{ID: "1", Name: "Ana"}, nil
+		}
+
+		var wg sync.WaitGroup
+		results := make([]user, 10)
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], _ = GetOrLoad(ctx, "user:1", time.Hour, loader)
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if calls.Load() != 1 {
+			t.Errorf("loader deveria rodar uma vez, rodou %d", calls.Load())
+		}
+		for _, u := range results {
+			if u.Name != "Ana" {
+				t.Fatalf("resultado inesperado: %+v", u)
+			}
+		}
+		if ttl := mr.TTL("app:user:1"); ttl > time.Hour || ttl < 54*time.Minute {
+			t.Errorf("TTL com jitter fora do intervalo: %s", ttl)
+		}
+	})
+
+	t.Run("cache negativo", func(t *testing.T) {
+		var calls atomic.Int32
+		loader := func(context.Context) (user, error) {
+			calls.Add(1)
+			return user{}, ErrNotFound
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := GetOrLoad(ctx, "user:2", time.Hour, loader); !errors.Is(err, ErrNotFound) {
+				t.Errorf("esperava ErrNotFound, recebeu %v", err)
+			}
+		}
+		if calls.Load() != 1 || !mr.Exists("app:user:2") {
+			t.Errorf("ausência deveria ficar em cache, loader rodou %d vezes", calls.Load())
+		}
+	})
+
+	t.Run("L1 serve sem redis e delete invalida", func(t *testing.T) {
+		mr.Del("app:user:1")
+		u, err := GetOrLoad(ctx, "user:1", time.Hour, func(context.Context) (user, error) {
+			return user{}, errors.New("não deveria carregar")
+		})
+		if err != nil || u.Name != "Ana" {
+			t.Errorf("esperava valor do L1, recebeu %+v %v", u, err)
+		}
+
+		if err := Default().Delete(ctx, "user:1"); err != nil {
+			t.Fatal(err)
+		}
+		u, _ = GetOrLoad(ctx, "user:1", time.Hour, func(context.Context) (user, error) {
+			return user{ID: "1", Name: "Bia"}, nil
+		})
+		if u.Name != "Bia" {
+			t.Errorf("esperava valor recarregado, recebeu %+v", u)
+		}
+	})
+	t.Run("loader travado respeita LoadTimeout", func(t *testing.T) {
+		c := New(client, Options{LoadTimeout: 20 * time.Millisecond})
+		_, err := GetOrLoadFrom(ctx, c, "lento", time.Minute, func(ctx context.Context) (int, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("esperava DeadlineExceeded, recebeu %v", err)
+		}
+		v, err := GetOrLoadFrom(ctx, c, "lento", time.Minute, func(context.Context) (int, error) { return 7, nil })
+		if err != nil || v != 7 {
+			t.Errorf("a chave deveria ser liberada após o timeout, recebeu %d %v", v, err)
+		}
+	})
+}
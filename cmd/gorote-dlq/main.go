@@ -0,0 +1,149 @@
+// Command gorote-dlq inspects and redrives RabbitMQ and SQS dead-letter
+// queues.
+//
+// Usage:
+//
+//	gorote-dlq -broker sqs -queue https://sqs.../orders-dlq count
+//	gorote-dlq -broker rabbitmq -queue orders.dlq -limit 10 peek
+//	gorote-dlq -broker sqs -queue ... -header tenant=acme -out dlq.jsonl export
+//	gorote-dlq -broker rabbitmq -queue orders.dlq -rate 20 redrive
+//
+// RabbitMQ connections are configured through RABBITMQ_USER, RABBITMQ_PASSWORD,
+// RABBITMQ_HOST, RABBITMQ_PORT and RABBITMQ_VHOST. SQS uses AWS_REGION, the
+// default AWS credential chain and, optionally, SQS_ENDPOINT.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/go-gorote/gorote"
+)
+
+type headerFlags []string
+
+func (h *headerFlags) String() string { return strings.Join(*h, ",") }
+
+func (h *headerFlags) Set(v string) error {
+	*h = append(*h, v)
+	return nil
+}
+
+func main() {
+	broker := flag.String("broker", "sqs", "broker of the dead-letter queue: rabbitmq or sqs")
+	queue := flag.String("queue", "", "dead-letter queue name (rabbitmq) or URL (sqs)")
+	target := flag.String("target", "", "queue to redrive to, defaults to the source of each message")
+	limit := flag.Int("limit", 0, "maximum number of messages, 0 for all")
+	rate := flag.Float64("rate", 0, "maximum messages redriven per second, 0 for unlimited")
+	out := flag.String("out", "", "file to export to, defaults to stdout")
+	var headers headerFlags
+	flag.Var(&headers, "header", "only messages whose header matches key=pattern, or has key; repeatable")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: gorote-dlq [flags] count|peek|export|redrive\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *queue == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dlq, err := open(ctx, *broker, *queue)
+	if err != nil {
+		log.Fatal(err)
+	}
+	filters := make([]gorote.DeadLetterFilter, len(headers))
+	for i, h := range headers {
+		key, value, _ := strings.Cut(h, "=")
+		filters[i] = gorote.HeaderFilter(key, value)
+	}
+	filter := gorote.AllFilters(filters...)
+
+	switch flag.Arg(0) {
+	case "count":
+		n, err := dlq.Count(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(n)
+	case "peek":
+		letters, err := dlq.Peek(ctx, *limit, filter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, d := range letters {
+			fmt.Printf("%s\t%s\tattempts=%d\t%s\n", d.ID, d.Source, d.Attempts, truncate(d.Body, 120))
+		}
+	case "export":
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		n, err := gorote.ExportDeadLetters(ctx, dlq, w, *limit, filter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%d mensagens exportadas", n)
+	case "redrive":
+		result, err := dlq.Redrive(ctx, gorote.RedriveOptions{Limit: *limit, Filter: filter, Rate: *rate, Target: *target})
+		if result != nil {
+			log.Printf("%d mensagens reenviadas, %d ignoradas", result.Moved, result.Skipped)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func open(ctx context.Context, broker, queue string) (gorote.DeadLetterQueue, error) {
+	switch broker {
+	case "rabbitmq":
+		init := gorote.InitRabbitMQ{
+			User:     gorote.MustEnvAsString("RABBITMQ_USER", "guest"),
+			Password: gorote.MustEnvAsString("RABBITMQ_PASSWORD", "guest"),
+			Host:     gorote.MustEnvAsString("RABBITMQ_HOST", "localhost"),
+			Port:     gorote.MustEnvAsInt("RABBITMQ_PORT", 5672),
+		}
+		conn := &gorote.ConnRabbitMQ{}
+		if err := init.ConnectRabbitMQ(conn, gorote.MustEnvAsString("RABBITMQ_VHOST", "/"), "gorote-dlq"); err != nil {
+			return nil, err
+		}
+		return conn.DeadLetterQueue(queue), nil
+	case "sqs":
+		init := gorote.InitSQS{
+			Region:   os.Getenv("AWS_REGION"),
+			Endpoint: os.Getenv("SQS_ENDPOINT"),
+		}
+		conn, err := init.Connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return conn.DeadLetterQueue(queue), nil
+	}
+	return nil, fmt.Errorf("unknown broker %q", broker)
+}
+
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,178 @@
+package gorote
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const meterName = "github.com/go-gorote/gorote"
+
+// ConsumerMetrics records OTel metrics for a RabbitMQ or SQS consumer and keeps
+// the state reported by HealthRabbitMQ and HealthSQS. Assign it to the Metrics
+// field of ConnRabbitMQ or ConnSQS. A nil *ConsumerMetrics records nothing.
+type ConsumerMetrics struct {
+	// StaleAfter flags the consumer as lagging in its health report when no
+	// message arrived for this long, even if SQS polls keep succeeding. Only
+	// set it for queues expected to receive steadily. Zero disables the check.
+	StaleAfter time.Duration
+
+	name       string
+	received   metric.Int64Counter
+	acked      metric.Int64Counter
+	nacked     metric.Int64Counter
+	failed     metric.Int64Counter
+	reconnects metric.Int64Counter
+	inFlight   metric.Int64UpDownCounter
+	latency    metric.Float64Histogram
+
+	inFlightCount atomic.Int64
+	mu            sync.Mutex
+	lastReceive   time.Time
+	lastPoll      time.Time
+	lastError     string
+	lastErrorAt   time.Time
+}
+
+func NewConsumerMetrics(name string) (*ConsumerMetrics, error) {
+	meter := otel.Meter(meterName)
+	m := &ConsumerMetrics{name: name}
+	var err error
+	if m.received, err = meter.Int64Counter("messaging.consumer.received",
+		metric.WithDescription("Messages received by the consumer")); err != nil {
+		return nil, err
+	}
+	if m.acked, err = meter.Int64Counter("messaging.consumer.acked",
+		metric.WithDescription("Messages acknowledged after a successful handler")); err != nil {
+		return nil, err
+	}
+	if m.nacked, err = meter.Int64Counter("messaging.consumer.nacked",
+		metric.WithDescription("Messages rejected back to the broker")); err != nil {
+		return nil, err
+	}
+	if m.failed, err = meter.Int64Counter("messaging.consumer.failed",
+		metric.WithDescription("Messages whose handler or acknowledgement failed")); err != nil {
+		return nil, err
+	}
+	if m.reconnects, err = meter.Int64Counter("messaging.consumer.reconnects",
+		metric.WithDescription("Connection or consumer re-registrations")); err != nil {
+		return nil, err
+	}
+	if m.inFlight, err = meter.Int64UpDownCounter("messaging.consumer.in_flight",
+		metric.WithDescription("Messages currently being handled")); err != nil {
+		return nil, err
+	}
+	if m.latency, err = meter.Float64Histogram("messaging.consumer.duration",
+		metric.WithDescription("Handler duration"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *ConsumerMetrics) attrs(queue string) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("messaging.consumer", m.name),
+		attribute.String("messaging.destination", queue),
+	)
+}
+
+// start records a received message and returns the function to call with the
+// handler result once it finishes.
+func (m *ConsumerMetrics) start(queue string) func(err error) {
+	if m == nil {
+		return func(error) {}
+	}
+	begin := time.Now()
+	ctx := context.Background()
+	attrs := m.attrs(queue)
+	m.received.Add(ctx, 1, attrs)
+	m.inFlight.Add(ctx, 1, attrs)
+	m.inFlightCount.Add(1)
+	m.touch()
+	return func(err error) {
+		m.latency.Record(ctx, time.Since(begin).Seconds(), attrs)
+		m.inFlight.Add(ctx, -1, attrs)
+		m.inFlightCount.Add(-1)
+		if err != nil {
+			m.failed.Add(ctx, 1, attrs)
+		}
+	}
+}
+
+func (m *ConsumerMetrics) ack(queue string, err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.failed.Add(context.Background(), 1, m.attrs(queue))
+		m.setError(err)
+		return
+	}
+	m.acked.Add(context.Background(), 1, m.attrs(queue))
+}
+
+func (m *ConsumerMetrics) nack(queue string) {
+	if m == nil {
+		return
+	}
+	m.nacked.Add(context.Background(), 1, m.attrs(queue))
+}
+
+func (m *ConsumerMetrics) reconnect(queue string) {
+	if m == nil {
+		return
+	}
+	m.reconnects.Add(context.Background(), 1, m.attrs(queue))
+}
+
+// poll records the result of a receive call, used by pull-based consumers. A
+// successful poll clears the last error but, empty or not, does not count as a
+// received message; start does that for each message.
+func (m *ConsumerMetrics) poll(err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.setError(err)
+		return
+	}
+	m.mu.Lock()
+	m.lastPoll = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *ConsumerMetrics) touch() {
+	m.mu.Lock()
+	m.lastReceive = time.Now()
+	m.mu.Unlock()
+}
+
+func (m *ConsumerMetrics) setError(err error) {
+	m.mu.Lock()
+	m.lastError = err.Error()
+	m.lastErrorAt = time.Now()
+	m.mu.Unlock()
+}
+
+// report fills the consumer fields of h.
+func (m *ConsumerMetrics) report(h *Health) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.lastReceive.IsZero() {
+		last := m.lastReceive
+		h.LastReceive = &last
+	}
+	h.InFlight = m.inFlightCount.Load()
+	if m.lastError != "" && m.lastErrorAt.After(m.lastReceive) && m.lastErrorAt.After(m.lastPoll) {
+		h.Error = m.lastError
+	}
+	if m.StaleAfter > 0 && !m.lastReceive.IsZero() && time.Since(m.lastReceive) > m.StaleAfter {
+		h.Message = fmt.Sprintf("no message received for %s", time.Since(m.lastReceive).Round(time.Second))
+	}
+}
@@ -0,0 +1,130 @@
+package gorote
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type HandlesRabbitMQ func(delivery amqp.Delivery) error
+
+type MiddlewareRabbitMQ func(HandlesRabbitMQ) HandlesRabbitMQ
+
+type MiddlewareSQS func(HandlesSQS) HandlesSQS
+
+// ChainRabbitMQ wraps handler with middlewares; the first one is the outermost.
+func ChainRabbitMQ(handler HandlesRabbitMQ, middlewares ...MiddlewareRabbitMQ) HandlesRabbitMQ {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// ChainSQS wraps handler with middlewares; the first one is the outermost.
+func ChainSQS(handler HandlesSQS, middlewares ...MiddlewareSQS) HandlesSQS {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// RecoverRabbitMQ turns a panic in the handler into an error, so the delivery
+// is not acked instead of the whole process crashing.
+func RecoverRabbitMQ() MiddlewareRabbitMQ {
+	return func(next HandlesRabbitMQ) HandlesRabbitMQ {
+		return func(d amqp.Delivery) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic in handler: %v\n%s", r, debug.Stack())
+				}
+			}()
+			return next(d)
+		}
+	}
+}
+
+// RecoverSQS turns a panic in the handler into an error, so the message is not
+// deleted instead of the whole process crashing.
+func RecoverSQS() MiddlewareSQS {
+	return func(next HandlesSQS) HandlesSQS {
+		return func(ctx context.Context, m types.Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic in handler: %v\n%s", r, debug.Stack())
+				}
+			}()
+			return next(ctx, m)
+		}
+	}
+}
+
+// LoggerRabbitMQ logs every delivery with its outcome and duration. A
+// delivery does not carry the queue it came from, so it is identified by its
+// exchange and routing key. A nil logger uses slog.Default().
+func LoggerRabbitMQ(logger *slog.Logger) MiddlewareRabbitMQ {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next HandlesRabbitMQ) HandlesRabbitMQ {
+		return func(d amqp.Delivery) error {
+			start := time.Now()
+			err := next(d)
+			attrs := []any{
+				slog.String("broker", "rabbitmq"),
+				slog.String("exchange", d.Exchange),
+				slog.String("routing_key", d.RoutingKey),
+				slog.String("message_id", d.MessageId),
+				slog.Int("redelivery", Redelivery(d)),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				logger.Error("message handler failed", append(attrs, slog.String("error", err.Error()))...)
+				return err
+			}
+			logger.Info("message handled", attrs...)
+			return nil
+		}
+	}
+}
+
+// LoggerSQS logs every message with its outcome and duration. A nil logger
+// uses slog.Default().
+func LoggerSQS(logger *slog.Logger) MiddlewareSQS {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next HandlesSQS) HandlesSQS {
+		return func(ctx context.Context, m types.Message) error {
+			start := time.Now()
+			err := next(ctx, m)
+			attrs := []any{
+				slog.String("broker", "sqs"),
+				slog.String("message_id", aws.ToString(m.MessageId)),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				logger.ErrorContext(ctx, "message handler failed", append(attrs, slog.String("error", err.Error()))...)
+				return err
+			}
+			logger.InfoContext(ctx, "message handled", attrs...)
+			return nil
+		}
+	}
+}
+
+// TimeoutSQS cancels the handler context after timeout.
+func TimeoutSQS(timeout time.Duration) MiddlewareSQS {
+	return func(next HandlesSQS) HandlesSQS {
+		return func(ctx context.Context, m types.Message) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, m)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package gorote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	t.Run("rabbitmq converte panic em erro", func(t *testing.T) {
+		handler := ChainRabbitMQ(func(d amqp.Delivery) error {
+			panic("boom")
+		}, RecoverRabbitMQ())
+
+		err := handler(amqp.Delivery{})
+		if err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("esperava erro com panic, recebeu: %v", err)
+		}
+	})
+
+	t.Run("sqs converte panic em erro", func(t *testing.T) {
+		handler := ChainSQS(func(ctx context.Context, m types.Message) error {
+			panic("boom")
+		}, RecoverSQS(), LoggerSQS(nil))
+
+		err := handler(context.Background(), types.Message{})
+		if err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("esperava erro com panic, recebeu: %v", err)
+		}
+	})
+}
+
+func TestChainRabbitMQ(t *testing.T) {
+	var order []string
+	mw := func(name string) MiddlewareRabbitMQ {
+		return func(next HandlesRabbitMQ) HandlesRabbitMQ {
+			return func(d amqp.Delivery) error {
+				order = append(order, name)
+				return next(d)
+			}
+		}
+	}
+	handler := ChainRabbitMQ(func(d amqp.Delivery) error {
+		order = append(order, "handler")
+		return nil
+	}, mw("a"), mw("b"))
+
+	if err := handler(amqp.Delivery{}); err != nil {
+		t.Fatalf("erro inesperado: %v", err)
+	}
+	if strings.Join(order, ",") != "a,b,handler" {
+		t.Errorf("ordem inesperada: %v", order)
+	}
+}
+
+func TestLoggerRabbitMQ(t *testing.T) {
+	var buf bytes.Buffer
+	handler := ChainRabbitMQ(func(d amqp.Delivery) error {
+		return nil
+	}, LoggerRabbitMQ(slog.New(slog.NewJSONHandler(&buf, nil))))
+
+	if err := handler(amqp.Delivery{Exchange: "pedidos", RoutingKey: "pedido.criado"}); err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["exchange"] != "pedidos" || entry["routing_key"] != "pedido.criado" || entry["queue"] != nil {
+		t.Errorf("campos de log inesperados: %v", entry)
+	}
+}
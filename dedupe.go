@@ -0,0 +1,130 @@
+package gorote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/go-redis/redis/v8"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	dedupeProcessing = "processing"
+	dedupeDone       = "done"
+)
+
+// ErrDuplicateInProgress is returned when another consumer is still handling
+// the same message, so it is not acknowledged and will be retried later. The
+// RabbitMQ wrapper also nacks the delivery with requeue.
+var ErrDuplicateInProgress = errors.New("dedupe: message is being processed by another consumer")
+
+// Deduplicator skips messages already handled successfully. A message is
+// claimed with SETNX before the handler runs, marked done only when it
+// succeeds and released when it fails so a redelivery can try again.
+type Deduplicator struct {
+	Redis  *redis.Client
+	Prefix string
+	// ProcessingTTL bounds the claim, so a consumer that dies mid-handler
+	// does not block the message forever. A handler running longer than it
+	// loses the claim and a redelivery may run concurrently, so set it above
+	// the longest handler duration. Defaults to 5 minutes.
+	ProcessingTTL time.Duration
+	TTL           time.Duration
+}
+
+func NewDeduplicator(client *redis.Client, ttl time.Duration) *Deduplicator {
+	return &Deduplicator{
+		Redis:         client,
+		Prefix:        "gorote:dedupe:",
+		ProcessingTTL: 5 * time.Minute,
+		TTL:           ttl,
+	}
+}
+
+// MessageIDRabbitMQ returns the AMQP MessageId or, when absent, a hash of the body.
+func MessageIDRabbitMQ(d amqp.Delivery) string {
+	if d.MessageId != "" {
+		return d.MessageId
+	}
+	return hashPayload(d.Body)
+}
+
+// MessageIDSQS returns the SQS MessageId or, when absent, a hash of the body.
+func MessageIDSQS(m types.Message) string {
+	if m.MessageId != nil && *m.MessageId != "" {
+		return *m.MessageId
+	}
+	if m.Body == nil {
+		return hashPayload(nil)
+	}
+	return hashPayload([]byte(*m.Body))
+}
+
+func hashPayload(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// RabbitMQ wraps a handler accepted by ConnRabbitMQ.Consumer; ctx should be
+// the one given to the consumer. A delivery being handled elsewhere is nacked
+// with requeue, since Consumer leaves failed deliveries unsettled.
+func (d *Deduplicator) RabbitMQ(ctx context.Context, f HandlesRabbitMQ) HandlesRabbitMQ {
+	return func(delivery amqp.Delivery) error {
+		err := d.run(ctx, MessageIDRabbitMQ(delivery), func() error {
+			return f(delivery)
+		})
+		if errors.Is(err, ErrDuplicateInProgress) {
+			if nackErr := delivery.Nack(false, true); nackErr != nil {
+				log.Printf("[Dedupe] Erro ao fazer NACK: %v", nackErr)
+			}
+		}
+		return err
+	}
+}
+
+// SQS wraps a handler accepted by ConnSQS.ConsumerMessages.
+func (d *Deduplicator) SQS(handler HandlesSQS) HandlesSQS {
+	return func(ctx context.Context, m types.Message) error {
+		return d.run(ctx, MessageIDSQS(m), func() error {
+			return handler(ctx, m)
+		})
+	}
+}
+
+func (d *Deduplicator) run(ctx context.Context, id string, handle func() error) error {
+	key := d.Prefix + id
+	claimed, err := d.Redis.SetNX(ctx, key, dedupeProcessing, d.ProcessingTTL).Result()
+	if err != nil {
+		return fmt.Errorf("dedupe: failed to claim message: %w", err)
+	}
+	if !claimed {
+		state, err := d.Redis.Get(ctx, key).Result()
+		switch {
+		case err == nil && state == dedupeDone:
+			return nil
+		case errors.Is(err, redis.Nil):
+			return d.run(ctx, id, handle)
+		case err != nil:
+			return fmt.Errorf("dedupe: failed to read message state: %w", err)
+		default:
+			return ErrDuplicateInProgress
+		}
+	}
+
+	if err := handle(); err != nil {
+		d.Redis.Del(context.WithoutCancel(ctx), key)
+		return err
+	}
+	// The handler already succeeded, so redelivering would run it again. If
+	// the mark is lost the claim expires after ProcessingTTL instead.
+	if err := d.Redis.Set(context.WithoutCancel(ctx), key, dedupeDone, d.TTL).Err(); err != nil {
+		log.Printf("[Dedupe] Erro ao marcar mensagem %s como processada: %v", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/go-redis/redis/v8"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDeduplicator(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	d := NewDeduplicator(client, time.Hour)
+	ctx := context.Background()
+	message := func(id string) types.Message {
+		return types.Message{MessageId: aws.String(id), Body: aws.String("{}")}
+	}
+
+	t.Run("mensagem repetida não roda de novo", func(t *testing.T) {
+		calls := 0
+		handler := d.SQS(func(context.Context, types.Message) error {
+			calls++
+			return nil
+		})
+		for i := 0; i < 2; i++ {
+			if err := handler(ctx, message("m1")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("handler deveria rodar uma vez, rodou %d", calls)
+		}
+		if state, _ := mr.Get(d.Prefix + "m1"); state != dedupeDone {
+			t.Errorf("esperava estado %q, recebeu %q", dedupeDone, state)
+		}
+	})
+
+	t.Run("falha libera a mensagem para nova tentativa", func(t *testing.T) {
+		calls := 0
+		handler := d.SQS(func(context.Context, types.Message) error {
+			calls++
+			if calls == 1 {
+				return errors.New("falhou")
+			}
+			return nil
+		})
+		if err := handler(ctx, message("m2")); err == nil {
+			t.Fatal("esperava o erro do handler")
+		}
+		if err := handler(ctx, message("m2")); err != nil {
+			t.Fatal(err)
+		}
+		if calls != 2 {
+			t.Errorf("handler deveria rodar duas vezes, rodou %d", calls)
+		}
+	})
+
+	t.Run("mensagem em processamento", func(t *testing.T) {
+		mr.Set(d.Prefix+"m3", dedupeProcessing)
+		handler := d.SQS(func(context.Context, types.Message) error {
+			t.Error("handler não deveria rodar")
+			return nil
+		})
+		if err := handler(ctx, message("m3")); !errors.Is(err, ErrDuplicateInProgress) {
+			t.Errorf("esperava ErrDuplicateInProgress, recebeu %v", err)
+		}
+	})
+
+	t.Run("RabbitMQ devolve à fila mensagem em processamento", func(t *testing.T) {
+		mr.Set(d.Prefix+"m5", dedupeProcessing)
+		ack := &fakeAcknowledger{}
+		handler := d.RabbitMQ(ctx, func(amqp.Delivery) error {
+			t.Error("handler não deveria rodar")
+			return nil
+		})
+		err := handler(amqp.Delivery{Acknowledger: ack, DeliveryTag: 7, MessageId: "m5"})
+		if !errors.Is(err, ErrDuplicateInProgress) {
+			t.Errorf("esperava ErrDuplicateInProgress, recebeu %v", err)
+		}
+		if fmt.Sprint(ack.acked, ack.nacked, ack.requeued) != "[] [7] [true]" {
+			t.Errorf("esperava nack com requeue, recebeu %v %v %v", ack.acked, ack.nacked, ack.requeued)
+		}
+	})
+
+	t.Run("RabbitMQ usa o contexto do consumidor", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		handler := d.RabbitMQ(canceled, func(amqp.Delivery) error {
+			t.Error("handler não deveria rodar com o contexto cancelado")
+			return nil
+		})
+		if err := handler(amqp.Delivery{MessageId: "m6"}); !errors.Is(err, context.Canceled) {
+			t.Errorf("esperava context.Canceled, recebeu %v", err)
+		}
+	})
+
+	t.Run("falha ao marcar como processada não reentrega", func(t *testing.T) {
+		handler := d.SQS(func(context.Context, types.Message) error {
+			mr.SetError("indisponível")
+			return nil
+		})
+		err := handler(ctx, message("m4"))
+		mr.SetError("")
+		if err != nil {
+			t.Errorf("handler já executou, esperava nil, recebeu %v", err)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+// DeadLetter is a message read from a dead-letter queue.
+type DeadLetter struct {
+	ID string `json:"id"`
+	// Source is the queue the message was dead-lettered from, when known.
+	Source    string            `json:"source,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body"`
+	Timestamp time.Time         `json:"timestamp,omitzero"`
+	// Attempts is how many times the message was delivered before landing in
+	// the dead-letter queue.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// DeadLetterFilter selects the messages an operation applies to. A nil filter
+// matches every message.
+type DeadLetterFilter func(DeadLetter) bool
+
+// HeaderFilter matches messages whose header key matches value, a path.Match
+// pattern. An empty value only requires the header to be present.
+func HeaderFilter(key, value string) DeadLetterFilter {
+	return func(d DeadLetter) bool {
+		v, ok := d.Headers[key]
+		if !ok || value == "" {
+			return ok
+		}
+		matched, _ := path.Match(value, v)
+		return matched
+	}
+}
+
+// AllFilters matches messages accepted by every filter.
+func AllFilters(filters ...DeadLetterFilter) DeadLetterFilter {
+	return func(d DeadLetter) bool {
+		for _, f := range filters {
+			if f != nil && !f(d) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (f DeadLetterFilter) match(d DeadLetter) bool {
+	return f == nil || f(d)
+}
+
+type RedriveOptions struct {
+	// Limit is the maximum number of messages moved. Zero moves all of them.
+	Limit  int
+	Filter DeadLetterFilter
+	// Rate caps the messages moved per second. Zero means unlimited.
+	Rate float64
+	// Target overrides the queue messages are sent to, which defaults to the
+	// queue each message was dead-lettered from.
+	Target string
+}
+
+type RedriveResult struct {
+	Moved   int
+	Skipped int
+}
+
+// DeadLetterQueue inspects and replays a dead-letter queue. It is implemented
+// by DLQRabbitMQ and DLQSQS.
+type DeadLetterQueue interface {
+	// Count returns the approximate number of messages in the queue.
+	Count(ctx context.Context) (int, error)
+	// Peek returns up to limit messages matching filter (all of them when
+	// limit is zero) and leaves them in the queue.
+	Peek(ctx context.Context, limit int, filter DeadLetterFilter) ([]DeadLetter, error)
+	// Redrive moves matching messages back to their source queue, or to
+	// opts.Target, removing them from the dead-letter queue.
+	Redrive(ctx context.Context, opts RedriveOptions) (*RedriveResult, error)
+}
+
+// ExportDeadLetters writes the messages returned by Peek to w as JSON lines and
+// returns how many were written.
+func ExportDeadLetters(ctx context.Context, dlq DeadLetterQueue, w io.Writer, limit int, filter DeadLetterFilter) (int, error) {
+	letters, err := dlq.Peek(ctx, limit, filter)
+	if err != nil {
+		return 0, err
+	}
+	enc := json.NewEncoder(w)
+	for i, d := range letters {
+		if err := enc.Encode(d); err != nil {
+			return i, fmt.Errorf("failed to export message %s: %w", d.ID, err)
+		}
+	}
+	return len(letters), nil
+}
+
+// throttle returns a function that blocks so it is called at most rate times
+// per second, or never blocks when rate is zero.
+func throttle(rate float64) func(ctx context.Context) error {
+	if rate <= 0 {
+		return func(ctx context.Context) error { return ctx.Err() }
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+	var next time.Time
+	return func(ctx context.Context) error {
+		if wait := time.Until(next); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		next = time.Now().Add(interval)
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,279 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"gorm.io/gorm"
+)
+
+const (
+	HealthUp       = "up"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+// HealthCheckFunc reports the state of a dependency. A returned error, or a
+// Health with status down, marks the check as failed.
+type HealthCheckFunc func(ctx context.Context) (*Health, error)
+
+type HealthCheck struct {
+	Name  string
+	Check HealthCheckFunc
+	// Timeout defaults to the timeout of the HealthRegistry.
+	Timeout time.Duration
+	// Critical checks make /readyz fail; the others only degrade it.
+	Critical bool
+}
+
+type HealthResult struct {
+	Health
+	Critical bool          `json:"critical"`
+	Duration time.Duration `json:"duration"`
+}
+
+type HealthReport struct {
+	Status    string                   `json:"status"`
+	Checks    map[string]*HealthResult `json:"checks"`
+	CheckedAt time.Time                `json:"checked_at"`
+}
+
+// HealthRegistry runs the registered checks in parallel and caches the report,
+// so frequent probes do not hammer the dependencies.
+type HealthRegistry struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu     sync.Mutex
+	checks []HealthCheck
+	report *HealthReport
+}
+
+// NewHealthRegistry returns a registry whose checks time out after timeout
+// unless they set their own, and whose report is cached for cacheTTL. Zero
+// values default to five seconds; a negative cacheTTL disables the cache.
+func NewHealthRegistry(timeout, cacheTTL time.Duration) *HealthRegistry {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if cacheTTL == 0 {
+		cacheTTL = 5 * time.Second
+	}
+	return &HealthRegistry{timeout: timeout, cacheTTL: cacheTTL}
+}
+
+// Register adds checks, which must have unique names since the report is
+// keyed by them. Nothing is registered when any of them is invalid.
+func (r *HealthRegistry) Register(checks ...HealthCheck) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make(map[string]bool, len(r.checks)+len(checks))
+	for _, check := range r.checks {
+		names[check.Name] = true
+	}
+	for _, check := range checks {
+		if check.Name == "" || check.Check == nil {
+			return fmt.Errorf("health check must have a name and a check function")
+		}
+		if names[check.Name] {
+			return fmt.Errorf("health check %s already registered", check.Name)
+		}
+		names[check.Name] = true
+	}
+	r.checks = append(r.checks, checks...)
+	r.report = nil
+	return nil
+}
+
+// Check returns the cached report or runs every check. Concurrent callers
+// wait for the same run.
+func (r *HealthRegistry) Check(ctx context.Context) HealthReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.report != nil && time.Since(r.report.CheckedAt) < r.cacheTTL {
+		return *r.report
+	}
+
+	report := HealthReport{Status: HealthUp, Checks: make(map[string]*HealthResult, len(r.checks)), CheckedAt: time.Now()}
+	results := make([]*HealthResult, len(r.checks))
+	var wg sync.WaitGroup
+	for i, check := range r.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for i, check := range r.checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		if result.Status != HealthDown {
+			continue
+		}
+		if check.Critical {
+			report.Status = HealthDown
+		} else if report.Status == HealthUp {
+			report.Status = HealthDegraded
+		}
+	}
+	r.report = &report
+	return report
+}
+
+func (r *HealthRegistry) run(ctx context.Context, check HealthCheck) (result *HealthResult) {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = r.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	result = &HealthResult{Critical: check.Critical}
+	defer func() {
+		if p := recover(); p != nil {
+			result.Status, result.Error = HealthDown, fmt.Sprintf("panic: %v", p)
+		}
+		result.Duration = time.Since(start)
+	}()
+
+	health, err := check.Check(ctx)
+	if health != nil {
+		result.Health = *health
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || (err == nil && ctx.Err() != nil):
+		result.Status, result.Error = HealthDown, fmt.Sprintf("timeout after %s", timeout)
+	case err != nil:
+		result.Status, result.Error = HealthDown, err.Error()
+	case result.Status == "":
+		result.Status = HealthUp
+	}
+	return result
+}
+
+// Livez reports that the process is running, without touching dependencies,
+// so a slow database never gets the pod restarted.
+func (r *HealthRegistry) Livez() fiber.Handler {
+	return Check()
+}
+
+// Readyz responds with the aggregated report, with 503 when a critical check
+// is down.
+func (r *HealthRegistry) Readyz() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		report := r.Check(ctx.UserContext())
+		status := fiber.StatusOK
+		if report.Status == HealthDown {
+			status = fiber.StatusServiceUnavailable
+		}
+		return ctx.Status(status).JSON(report)
+	}
+}
+
+// Routes registers /livez and /readyz on router.
+func (r *HealthRegistry) Routes(router fiber.Router) {
+	router.Get("/livez", r.Livez())
+	router.Get("/readyz", r.Readyz())
+}
+
+func CheckGorm(db *gorm.DB) HealthCheckFunc {
+	return func(ctx context.Context) (*Health, error) {
+		return healthGorm(ctx, db)
+	}
+}
+
+func CheckMongo(client *mongo.Client) HealthCheckFunc {
+	return func(ctx context.Context) (*Health, error) {
+		if err := client.Ping(ctx, readpref.Primary()); err != nil {
+			return nil, fmt.Errorf("mongo ping failed: %w", err)
+		}
+		return &Health{Status: HealthUp}, nil
+	}
+}
+
+func CheckRedis(client *redis.Client) HealthCheckFunc {
+	return func(ctx context.Context) (*Health, error) {
+		if err := client.Ping(ctx).Err(); err != nil {
+			return nil, fmt.Errorf("redis ping failed: %w", err)
+		}
+		pool := client.PoolStats()
+		return &Health{
+			Status:   HealthUp,
+			PoolOpen: int(pool.TotalConns),
+			PoolIdle: int(pool.IdleConns),
+		}, nil
+	}
+}
+
+func CheckRabbitMQ(conn *ConnRabbitMQ) HealthCheckFunc {
+	return func(context.Context) (*Health, error) {
+		return HealthRabbitMQ(conn)
+	}
+}
+
+// CheckSQS reads the attributes of queueURL, which checks both the network
+// and the credentials. With conn.Metrics set, consumer errors also fail it.
+func CheckSQS(conn *ConnSQS, queueURL string) HealthCheckFunc {
+	return func(ctx context.Context) (*Health, error) {
+		_, err := conn.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{QueueUrl: aws.String(queueURL)})
+		if err != nil {
+			return nil, fmt.Errorf("sqs queue unreachable: %w", err)
+		}
+		if conn.Metrics == nil {
+			return &Health{Status: HealthUp}, nil
+		}
+		return HealthSQS(*conn)
+	}
+}
+
+// BucketChecker is implemented by storage.MinIOStorage and storage.S3Storage.
+type BucketChecker interface {
+	BucketExists(ctx context.Context, bucket string) (bool, error)
+}
+
+func CheckBucket(storage BucketChecker, bucket string) HealthCheckFunc {
+	return func(ctx context.Context) (*Health, error) {
+		exists, err := storage.BucketExists(ctx, bucket)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("bucket %s not found", bucket)
+		}
+		return &Health{Status: HealthUp}, nil
+	}
+}
+
+// CheckGRPC waits for conn, such as the one from TelemetryConn, to be ready.
+// Idle connections are asked to connect first.
+func CheckGRPC(conn *grpc.ClientConn) HealthCheckFunc {
+	return func(ctx context.Context) (*Health, error) {
+		for {
+			state := conn.GetState()
+			switch state {
+			case connectivity.Ready:
+				return &Health{Status: HealthUp}, nil
+			case connectivity.Shutdown:
+				return nil, errors.New("grpc connection shut down")
+			case connectivity.Idle:
+				conn.Connect()
+			}
+			if !conn.WaitForStateChange(ctx, state) {
+				return nil, fmt.Errorf("grpc connection %s: %w", state, ctx.Err())
+			}
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestHealthRegistry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	conn, srv := newTestSQS(t)
+	queueURL := srv.CreateQueue("pedidos", nil)
+
+	var calls atomic.Int32
+	registry := NewHealthRegistry(time.Second, -1)
+	checks := []HealthCheck{
+		{Name: "redis", Check: CheckRedis(client), Critical: true},
+		{Name: "sqs", Check: CheckSQS(conn, queueURL), Critical: true},
+		{Name: "relatorios", Check: func(context.Context) (*Health, error) {
+			calls.Add(1)
+			return nil, errors.New("indisponível")
+		}},
+		{Name: "lento", Timeout: 20 * time.Millisecond, Check: func(ctx context.Context) (*Health, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}},
+	}
+	if err := registry.Register(checks...); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	registry.Routes(app)
+	readyz := func() (int, HealthReport) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/readyz", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var report HealthReport
+		json.NewDecoder(resp.Body).Decode(&report)
+		return resp.StatusCode, report
+	}
+
+	t.Run("checks não críticos apenas degradam", func(t *testing.T) {
+		code, report := readyz()
+		if code != fiber.StatusOK || report.Status != HealthDegraded {
+			t.Fatalf("esperava 200 degraded, recebeu %d %s", code, report.Status)
+		}
+		if r := report.Checks["redis"]; r == nil || r.Status != HealthUp || !r.Critical {
+			t.Errorf("redis deveria estar up, recebeu %+v", r)
+		}
+		if r := report.Checks["sqs"]; r == nil || r.Status != HealthUp {
+			t.Errorf("sqs deveria estar up, recebeu %+v", r)
+		}
+		if r := report.Checks["lento"]; r == nil || r.Error != "timeout after 20ms" {
+			t.Errorf("esperava timeout, recebeu %+v", r)
+		}
+	})
+
+	t.Run("check crítico fora retorna 503", func(t *testing.T) {
+		mr.Close()
+		code, report := readyz()
+		if code != fiber.StatusServiceUnavailable || report.Status != HealthDown {
+			t.Errorf("esperava 503 down, recebeu %d %s", code, report.Status)
+		}
+		resp, _ := app.Test(httptest.NewRequest("GET", "/livez", nil))
+		if resp.StatusCode != fiber.StatusOK {
+			t.Errorf("livez não deveria depender das dependências, recebeu %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("nomes repetidos são rejeitados", func(t *testing.T) {
+		if err := registry.Register(HealthCheck{Name: "redis", Check: CheckRedis(client)}); err == nil {
+			t.Error("esperava erro ao registrar redis duas vezes")
+		}
+		if err := NewHealthRegistry(0, 0).Register(checks[2], checks[2]); err == nil {
+			t.Error("esperava erro com nomes repetidos na mesma chamada")
+		}
+	})
+
+	t.Run("resultado em cache", func(t *testing.T) {
+		cached := NewHealthRegistry(time.Second, time.Minute)
+		cached.Register(checks...)
+		cached.Check(context.Background())
+		before := calls.Load()
+		for i := 0; i < 2; i++ {
+			if report := cached.Check(context.Background()); report.Status != HealthDown {
+				t.Errorf("esperava o relatório anterior, recebeu %s", report.Status)
+			}
+		}
+		if calls.Load() != before {
+			t.Errorf("checks não deveriam rodar com o relatório em cache, rodaram %d vezes", calls.Load()-before)
+		}
+	})
+}
+
+func TestHealthRabbitMQ(t *testing.T) {
+	conn := newTestRabbitMQ(t)
+	metrics, err := NewConsumerMetrics("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Metrics = metrics
+
+	if stats, _ := HealthRabbitMQ(conn); stats.Status != "up" {
+		t.Fatalf("esperava up, recebeu %+v", stats)
+	}
+	metrics.ack("pedidos", errors.New("canal fechado"))
+	if stats, _ := HealthRabbitMQ(conn); stats.Status != "down" || stats.Error != "canal fechado" {
+		t.Errorf("esperava down após falha no ack, recebeu %+v", stats)
+	}
+	metrics.start("pedidos")(nil)
+	if stats, _ := HealthRabbitMQ(conn); stats.Status != "up" {
+		t.Errorf("esperava up após nova mensagem, recebeu %+v", stats)
+	}
+}
+
+func TestHealthSQS(t *testing.T) {
+	metrics, err := NewConsumerMetrics("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics.StaleAfter = 20 * time.Millisecond
+	conn := ConnSQS{Metrics: metrics}
+
+	metrics.poll(nil)
+	if stats, _ := HealthSQS(conn); stats.Status != "up" || stats.LastReceive != nil {
+		t.Errorf("poll vazio não deveria contar como mensagem recebida: %+v", stats)
+	}
+	metrics.poll(errors.New("sem rede"))
+	if stats, _ := HealthSQS(conn); stats.Status != "down" {
+		t.Errorf("esperava down após falha no poll, recebeu %+v", stats)
+	}
+	metrics.poll(nil)
+	if stats, _ := HealthSQS(conn); stats.Status != "up" {
+		t.Errorf("poll bem-sucedido deveria limpar o erro, recebeu %+v", stats)
+	}
+
+	metrics.start("pedidos")(nil)
+	time.Sleep(30 * time.Millisecond)
+	metrics.poll(nil)
+	stats, _ := HealthSQS(conn)
+	if stats.LastReceive == nil || stats.Message == "It's healthy" {
+		t.Errorf("esperava aviso de consumidor parado apesar dos polls, recebeu %+v", stats)
+	}
+}
+
+func TestHealthGorm(t *testing.T) {
+	db := newTestOutboxDB(t)
+	stats, err := healthGorm(context.Background(), db)
+	if err != nil || stats.Status != "up" {
+		t.Fatalf("esperava banco disponível, recebeu %+v %v", stats, err)
+	}
+	if stats.PoolOpen < 1 || stats.OpenConnections != 0 {
+		t.Errorf("estatísticas do pool não deveriam ocupar os campos do servidor: %+v", stats)
+	}
+	body, _ := json.Marshal(stats)
+	var fields map[string]any
+	json.Unmarshal(body, &fields)
+	if _, ok := fields["open_connections"]; ok {
+		t.Errorf("open_connections é só do Postgres, recebeu %s", body)
+	}
+	if _, ok := fields["pool_open_connections"]; !ok {
+		t.Errorf("esperava pool_open_connections, recebeu %s", body)
+	}
+}
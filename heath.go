@@ -10,22 +10,35 @@ import (
 )
 
 type Health struct {
-	Status            string        `json:"status,omitempty"`
-	Error             string        `json:"error,omitempty"`
-	Message           string        `json:"message,omitempty"`
-	OpenConnections   int           `json:"open_connections,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+	// OpenConnections, Idle and WaitCount count the active, idle and waiting
+	// sessions of the whole database server. Only reported for Postgres.
+	OpenConnections int   `json:"open_connections,omitempty"`
+	Idle            int   `json:"idle,omitempty"`
+	WaitCount       int64 `json:"wait_count,omitempty"`
+	// Pool*, InUse, WaitDuration and Max*Closed describe the client's own
+	// connection pool.
+	PoolOpen          int           `json:"pool_open_connections,omitempty"`
+	PoolIdle          int           `json:"pool_idle,omitempty"`
+	PoolWaitCount     int64         `json:"pool_wait_count,omitempty"`
 	InUse             int           `json:"in_use,omitempty"`
-	Idle              int           `json:"idle,omitempty"`
-	WaitCount         int64         `json:"wait_count,omitempty"`
 	WaitDuration      time.Duration `json:"wait_duration,omitempty"`
 	MaxIdleClosed     int64         `json:"max_idle_closed,omitempty"`
 	MaxLifetimeClosed int64         `json:"max_lifetime_closed,omitempty"`
+	LastReceive       *time.Time    `json:"last_receive,omitempty"`
+	InFlight          int64         `json:"in_flight,omitempty"`
 }
 
 func HealthGorm(s *gorm.DB) (*Health, error) {
-	var stats Health
 	contx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	return healthGorm(contx, s)
+}
+
+func healthGorm(contx context.Context, s *gorm.DB) (*Health, error) {
+	var stats Health
 	if s == nil {
 		return nil, fmt.Errorf("failed to connect to DB")
 	}
@@ -41,14 +54,30 @@ func HealthGorm(s *gorm.DB) (*Health, error) {
 		stats.Error = fmt.Sprintf("db ping failed: %v", err)
 		return &stats, nil
 	}
-	sqlStats := `SELECT 
+	pool := sqlDB.Stats()
+	stats.PoolOpen = pool.OpenConnections
+	stats.InUse = pool.InUse
+	stats.PoolIdle = pool.Idle
+	stats.PoolWaitCount = pool.WaitCount
+	stats.WaitDuration = pool.WaitDuration
+	stats.MaxIdleClosed = pool.MaxIdleClosed
+	stats.MaxLifetimeClosed = pool.MaxLifetimeClosed
+	if s.Dialector != nil && s.Dialector.Name() == "postgres" {
+		sqlStats := `SELECT 
 			(SELECT count(*) FROM pg_stat_activity WHERE state = 'active') as open_connections,
 			(SELECT count(*) FROM pg_stat_activity WHERE state = 'idle') as idle,
 			(SELECT count(*) FROM pg_stat_activity WHERE wait_event IS NOT NULL) as wait_count
 		`
-	err = s.Raw(sqlStats).Scan(&stats).Error
-	if err != nil {
-		log.Printf("Failed to retrieve db stats: %v", err)
+		var server struct {
+			OpenConnections int
+			Idle            int
+			WaitCount       int64
+		}
+		err = s.WithContext(contx).Raw(sqlStats).Scan(&server).Error
+		if err != nil {
+			log.Printf("Failed to retrieve db stats: %v", err)
+		}
+		stats.OpenConnections, stats.Idle, stats.WaitCount = server.OpenConnections, server.Idle, server.WaitCount
 	}
 	stats.Status = "up"
 	stats.Message = "It's healthy"
@@ -60,3 +89,53 @@ func HealthGorm(s *gorm.DB) (*Health, error) {
 	}
 	return &stats, nil
 }
+
+// HealthRabbitMQ reports the state of conn and, when conn.Metrics is set, of
+// its consumers, which are down while their last ack failed.
+func HealthRabbitMQ(conn *ConnRabbitMQ) (*Health, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ")
+	}
+	var stats Health
+	if conn.Metrics != nil {
+		conn.Metrics.report(&stats)
+	}
+	if conn.Connection == nil || conn.Connection.IsClosed() {
+		stats.Status = "down"
+		stats.Error = "rabbitmq connection closed"
+		return &stats, nil
+	}
+	if conn.Channel == nil || conn.Channel.IsClosed() {
+		stats.Status = "down"
+		stats.Error = "rabbitmq channel closed"
+		return &stats, nil
+	}
+	if stats.Error != "" {
+		stats.Status = "down"
+		return &stats, nil
+	}
+	stats.Status = "up"
+	if stats.Message == "" {
+		stats.Message = "It's healthy"
+	}
+	return &stats, nil
+}
+
+// HealthSQS reports the state of the consumers using conn, based on the
+// result of their last ReceiveMessage call. It requires conn.Metrics.
+func HealthSQS(conn ConnSQS) (*Health, error) {
+	if conn.Metrics == nil {
+		return nil, fmt.Errorf("sqs consumer metrics not enabled")
+	}
+	var stats Health
+	conn.Metrics.report(&stats)
+	if stats.Error != "" {
+		stats.Status = "down"
+		return &stats, nil
+	}
+	stats.Status = "up"
+	if stats.Message == "" {
+		stats.Message = "It's healthy"
+	}
+	return &stats, nil
+}
@@ -0,0 +1,646 @@
+package gorote
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	JobQueued    = "queued"
+	JobScheduled = "scheduled"
+	JobActive    = "active"
+	JobDead      = "dead"
+
+	// MaxJobPriority bounds Job priorities to [-MaxJobPriority, MaxJobPriority].
+	MaxJobPriority = 100
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobExists is returned by Enqueue when a job with the same UniqueKey
+	// is still pending; the ID of that job is returned with it.
+	ErrJobExists = errors.New("job already exists")
+)
+
+// Job is a unit of work stored in Redis.
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Queue       string          `json:"queue"`
+	Payload     json.RawMessage `json:"payload"`
+	Priority    int             `json:"priority"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Status      string          `json:"status"`
+	LastError   string          `json:"last_error,omitempty"`
+	UniqueKey   string          `json:"unique_key,omitempty"`
+	Timeout     time.Duration   `json:"timeout"`
+	CreatedAt   time.Time       `json:"created_at"`
+	RunAt       time.Time       `json:"run_at"`
+}
+
+// Decode unmarshals the job payload into v.
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+type JobHandler func(ctx context.Context, job *Job) error
+
+// HandleJob adapts a typed function into a JobHandler, decoding the payload
+// as JSON.
+func HandleJob[T any](fn func(context.Context, T) error) JobHandler {
+	return func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := job.Decode(&payload); err != nil {
+			return fmt.Errorf("invalid job payload: %w", err)
+		}
+		return fn(ctx, payload)
+	}
+}
+
+// JobOptions customizes an enqueued job. Zero values fall back to the
+// JobQueue defaults.
+type JobOptions struct {
+	Queue string
+	// Priority from -MaxJobPriority to MaxJobPriority; higher runs first.
+	Priority    int
+	MaxAttempts int
+	Timeout     time.Duration
+	// Delay or RunAt schedule the job for later.
+	Delay time.Duration
+	RunAt time.Time
+	// UniqueKey rejects new jobs with the same key while one is pending, for
+	// at most UniqueFor (defaults to 24h).
+	UniqueKey string
+	UniqueFor time.Duration
+}
+
+type cronJob struct {
+	spec     string
+	schedule cron.Schedule
+	jobType  string
+	payload  any
+	opts     JobOptions
+}
+
+// JobQueue is a Redis-backed background job queue. Jobs wait in a sorted set
+// per queue ordered by priority and enqueue time; retries and delayed jobs
+// wait in a scheduled set until due. Running jobs are leased, so jobs of a
+// worker that died are picked up again once their timeout expires.
+type JobQueue struct {
+	Redis  *redis.Client
+	Prefix string
+	// Queues maps each queue to its number of workers. Defaults to
+	// {"default": 10}.
+	Queues       map[string]int
+	MaxAttempts  int
+	Timeout      time.Duration
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+
+	mu       sync.RWMutex
+	handlers map[string]JobHandler
+	crons    []cronJob
+}
+
+func NewJobQueue(client *redis.Client) *JobQueue {
+	return &JobQueue{
+		Redis:        client,
+		Prefix:       "gorote:jobs",
+		Queues:       map[string]int{"default": 10},
+		MaxAttempts:  5,
+		Timeout:      30 * time.Minute,
+		BaseBackoff:  5 * time.Second,
+		MaxBackoff:   time.Hour,
+		PollInterval: time.Second,
+		handlers:     make(map[string]JobHandler),
+	}
+}
+
+// Register sets the handler for jobs of jobType.
+func (q *JobQueue) Register(jobType string, handler JobHandler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[jobType] = handler
+}
+
+// Cron enqueues a jobType job on the given schedule, a standard cron
+// expression or a descriptor such as "@every 5m". With several replicas
+// running the queue, each tick is enqueued only once.
+func (q *JobQueue) Cron(spec, jobType string, payload any, opts JobOptions) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("invalid cron spec %q: %w", spec, err)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.crons = append(q.crons, cronJob{spec: spec, schedule: schedule, jobType: jobType, payload: payload, opts: opts})
+	return nil
+}
+
+func (q *JobQueue) jobKey(id string) string { return q.Prefix + ":job:" + id }
+
+func (q *JobQueue) stateKey(queue, state string) string {
+	return q.Prefix + ":" + queue + ":" + state
+}
+
+func (q *JobQueue) queuesKey() string { return q.Prefix + ":queues" }
+
+func (q *JobQueue) uniqueKey(key string) string { return q.Prefix + ":unique:" + key }
+
+// readyScore orders ready jobs by priority, then by the time they became
+// ready.
+func readyScore(priority int, at time.Time) float64 {
+	return float64(MaxJobPriority-priority)*1e13 + float64(at.UnixMilli())
+}
+
+// Enqueue stores a jobType job carrying payload and returns its ID.
+func (q *JobQueue) Enqueue(ctx context.Context, jobType string, payload any, opts JobOptions) (string, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize struct: %w", err)
+	}
+	now := time.Now()
+	job := &Job{
+		ID:          uuid.NewString(),
+		Type:        jobType,
+		Queue:       opts.Queue,
+		Payload:     raw,
+		Priority:    max(-MaxJobPriority, min(MaxJobPriority, opts.Priority)),
+		MaxAttempts: opts.MaxAttempts,
+		Timeout:     opts.Timeout,
+		UniqueKey:   opts.UniqueKey,
+		CreatedAt:   now,
+		RunAt:       now,
+	}
+	if job.Queue == "" {
+		job.Queue = "default"
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = q.MaxAttempts
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = q.Timeout
+	}
+	if opts.Delay > 0 {
+		job.RunAt = now.Add(opts.Delay)
+	}
+	if opts.RunAt.After(job.RunAt) {
+		job.RunAt = opts.RunAt
+	}
+
+	if job.UniqueKey != "" {
+		ttl := opts.UniqueFor
+		if ttl <= 0 {
+			ttl = 24 * time.Hour
+		}
+		ok, err := q.Redis.SetNX(ctx, q.uniqueKey(job.UniqueKey), job.ID, ttl).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to enqueue job: %w", err)
+		}
+		if !ok {
+			existing, _ := q.Redis.Get(ctx, q.uniqueKey(job.UniqueKey)).Result()
+			return existing, ErrJobExists
+		}
+	}
+
+	_, err = q.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, q.queuesKey(), job.Queue)
+		if job.RunAt.After(now) {
+			job.Status = JobScheduled
+			pipe.ZAdd(ctx, q.stateKey(job.Queue, JobScheduled), &redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.ID})
+		} else {
+			job.Status = JobQueued
+			pipe.ZAdd(ctx, q.stateKey(job.Queue, JobQueued), &redis.Z{Score: readyScore(job.Priority, now), Member: job.ID})
+		}
+		pipe.HSet(ctx, q.jobKey(job.ID), jobFields(job))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return job.ID, nil
+}
+
+func jobFields(job *Job) map[string]any {
+	return map[string]any{
+		"id":           job.ID,
+		"type":         job.Type,
+		"queue":        job.Queue,
+		"payload":      string(job.Payload),
+		"priority":     job.Priority,
+		"attempts":     job.Attempts,
+		"max_attempts": job.MaxAttempts,
+		"status":       job.Status,
+		"last_error":   job.LastError,
+		"unique_key":   job.UniqueKey,
+		"timeout_ms":   job.Timeout.Milliseconds(),
+		"created_at":   job.CreatedAt.UnixMilli(),
+		"run_at":       job.RunAt.UnixMilli(),
+	}
+}
+
+func parseJob(fields map[string]string) *Job {
+	atoi := func(k string) int {
+		n, _ := strconv.Atoi(fields[k])
+		return n
+	}
+	millis := func(k string) int64 {
+		n, _ := strconv.ParseInt(fields[k], 10, 64)
+		return n
+	}
+	return &Job{
+		ID:          fields["id"],
+		Type:        fields["type"],
+		Queue:       fields["queue"],
+		Payload:     json.RawMessage(fields["payload"]),
+		Priority:    atoi("priority"),
+		Attempts:    atoi("attempts"),
+		MaxAttempts: atoi("max_attempts"),
+		Status:      fields["status"],
+		LastError:   fields["last_error"],
+		UniqueKey:   fields["unique_key"],
+		Timeout:     time.Duration(millis("timeout_ms")) * time.Millisecond,
+		CreatedAt:   time.UnixMilli(millis("created_at")),
+		RunAt:       time.UnixMilli(millis("run_at")),
+	}
+}
+
+// Get returns the job with the given ID.
+func (q *JobQueue) Get(ctx context.Context, id string) (*Job, error) {
+	fields, err := q.Redis.HGetAll(ctx, q.jobKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrJobNotFound
+	}
+	return parseJob(fields), nil
+}
+
+// dequeueScript pops the next ready job and leases it until its timeout, plus
+// a minute of grace, has passed.
+var dequeueScript = redis.NewScript(`
+local popped = redis.call('ZPOPMIN', KEYS[1])
+if #popped == 0 then
+	return false
+end
+local id = popped[1]
+local key = ARGV[2] .. id
+local timeout = tonumber(redis.call('HGET', key, 'timeout_ms') or ARGV[3])
+redis.call('ZADD', KEYS[2], string.format('%.0f', tonumber(ARGV[1]) + timeout + 60000), id)
+redis.call('HSET', key, 'status', 'active')
+return id
+`)
+
+// promoteScript moves the jobs of KEYS[1] whose score is due back to the
+// ready set KEYS[2]. It serves both scheduled jobs and expired leases.
+var promoteScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	local key = ARGV[2] .. id
+	if redis.call('EXISTS', key) == 1 then
+		local priority = tonumber(redis.call('HGET', key, 'priority') or '0')
+		redis.call('ZADD', KEYS[2], string.format('%.0f', (ARGV[3] - priority) * 1e13 + now), id)
+		redis.call('HSET', key, 'status', 'queued')
+	end
+end
+return #ids
+`)
+
+// Run processes jobs of every queue in Queues, moves due scheduled jobs and
+// fires cron entries until ctx is cancelled. Running jobs are waited for.
+func (q *JobQueue) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for queue, workers := range q.Queues {
+		if _, err := q.Redis.SAdd(ctx, q.queuesKey(), queue).Result(); err != nil {
+			return fmt.Errorf("failed to register queue %s: %w", queue, err)
+		}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				q.work(ctx, queue)
+			}()
+		}
+	}
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		q.promote(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		q.runCron(ctx)
+	}()
+	wg.Wait()
+	return nil
+}
+
+func (q *JobQueue) promote(ctx context.Context) {
+	ticker := time.NewTicker(q.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := q.promoteDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("[Jobs] Erro ao promover jobs agendados: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *JobQueue) promoteDue(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	for queue := range q.Queues {
+		for _, state := range []string{JobScheduled, JobActive} {
+			err := promoteScript.Run(ctx, q.Redis, []string{q.stateKey(queue, state), q.stateKey(queue, JobQueued)},
+				now, q.jobKey(""), MaxJobPriority).Err()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (q *JobQueue) work(ctx context.Context, queue string) {
+	for ctx.Err() == nil {
+		job, err := q.dequeue(ctx, queue)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[Jobs] Erro ao buscar job na fila %s: %v", queue, err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.PollInterval):
+			}
+			continue
+		}
+		q.process(context.WithoutCancel(ctx), job)
+	}
+}
+
+func (q *JobQueue) dequeue(ctx context.Context, queue string) (*Job, error) {
+	id, err := dequeueScript.Run(ctx, q.Redis, []string{q.stateKey(queue, JobQueued), q.stateKey(queue, JobActive)},
+		time.Now().UnixMilli(), q.jobKey(""), q.Timeout.Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	job, err := q.Get(ctx, id)
+	if errors.Is(err, ErrJobNotFound) {
+		q.Redis.ZRem(ctx, q.stateKey(queue, JobActive), id)
+		return nil, nil
+	}
+	return job, err
+}
+
+// process runs job and records the outcome: done jobs are removed, failed
+// ones are rescheduled with backoff or moved to the dead set.
+func (q *JobQueue) process(ctx context.Context, job *Job) {
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Type]
+	q.mu.RUnlock()
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("no handler registered for job type %s", job.Type)
+	} else {
+		runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+		err = runJob(runCtx, handler, job)
+		cancel()
+	}
+
+	if err == nil {
+		err = q.remove(ctx, job, JobActive)
+	} else {
+		log.Printf("[Jobs] Job %s (%s) falhou na tentativa %d: %v", job.ID, job.Type, job.Attempts+1, err)
+		err = q.retry(ctx, job, err)
+	}
+	if err != nil {
+		log.Printf("[Jobs] Erro ao atualizar job %s: %v", job.ID, err)
+	}
+}
+
+func runJob(ctx context.Context, handler JobHandler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+func (q *JobQueue) retry(ctx context.Context, job *Job, cause error) error {
+	if n, err := q.Redis.Exists(ctx, q.jobKey(job.ID)).Result(); err != nil || n == 0 {
+		// Deleted while running.
+		return err
+	}
+	job.Attempts++
+	job.LastError = cause.Error()
+	_, err := q.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, q.stateKey(job.Queue, JobActive), job.ID)
+		if job.Attempts >= job.MaxAttempts {
+			job.Status = JobDead
+			pipe.ZAdd(ctx, q.stateKey(job.Queue, JobDead), &redis.Z{Score: float64(time.Now().UnixMilli()), Member: job.ID})
+			q.releaseUnique(ctx, pipe, job)
+		} else {
+			job.Status = JobScheduled
+			job.RunAt = time.Now().Add(backoffDelay(job.Attempts-1, q.BaseBackoff, q.MaxBackoff))
+			pipe.ZAdd(ctx, q.stateKey(job.Queue, JobScheduled), &redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.ID})
+		}
+		pipe.HSet(ctx, q.jobKey(job.ID), jobFields(job))
+		return nil
+	})
+	return err
+}
+
+// releaseUnique frees the unique key of job so an equal job can be enqueued.
+func (q *JobQueue) releaseUnique(ctx context.Context, pipe redis.Pipeliner, job *Job) {
+	if job.UniqueKey != "" {
+		pipe.Del(ctx, q.uniqueKey(job.UniqueKey))
+	}
+}
+
+// remove deletes job from state and from Redis.
+func (q *JobQueue) remove(ctx context.Context, job *Job, states ...string) error {
+	_, err := q.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, state := range states {
+			pipe.ZRem(ctx, q.stateKey(job.Queue, state), job.ID)
+		}
+		pipe.Del(ctx, q.jobKey(job.ID))
+		q.releaseUnique(ctx, pipe, job)
+		return nil
+	})
+	return err
+}
+
+// Retry moves a scheduled or dead job to the front of its priority in the
+// ready set. Dead jobs get their attempts reset.
+func (q *JobQueue) Retry(ctx context.Context, id string) error {
+	job, err := q.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if job.Status == JobActive || job.Status == JobQueued {
+		return fmt.Errorf("job %s is %s", id, job.Status)
+	}
+	if job.Status == JobDead {
+		job.Attempts = 0
+	}
+	job.Status = JobQueued
+	job.RunAt = time.Now()
+	_, err = q.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, q.stateKey(job.Queue, JobScheduled), id)
+		pipe.ZRem(ctx, q.stateKey(job.Queue, JobDead), id)
+		pipe.ZAdd(ctx, q.stateKey(job.Queue, JobQueued), &redis.Z{Score: readyScore(job.Priority, job.RunAt), Member: id})
+		pipe.HSet(ctx, q.jobKey(id), jobFields(job))
+		return nil
+	})
+	return err
+}
+
+// Delete removes a job in any state. A running job still finishes, but its
+// outcome is not recorded.
+func (q *JobQueue) Delete(ctx context.Context, id string) error {
+	job, err := q.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return q.remove(ctx, job, JobQueued, JobScheduled, JobActive, JobDead)
+}
+
+type JobQueueStats struct {
+	Queue     string `json:"queue"`
+	Queued    int64  `json:"queued"`
+	Scheduled int64  `json:"scheduled"`
+	Active    int64  `json:"active"`
+	Dead      int64  `json:"dead"`
+}
+
+// Stats returns the number of jobs in each state of every known queue.
+func (q *JobQueue) Stats(ctx context.Context) ([]JobQueueStats, error) {
+	queues, err := q.Redis.SMembers(ctx, q.queuesKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]JobQueueStats, len(queues))
+	cmds := make([][4]*redis.IntCmd, len(queues))
+	_, err = q.Redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, queue := range queues {
+			for j, state := range []string{JobQueued, JobScheduled, JobActive, JobDead} {
+				cmds[i][j] = pipe.ZCard(ctx, q.stateKey(queue, state))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, queue := range queues {
+		stats[i] = JobQueueStats{
+			Queue:     queue,
+			Queued:    cmds[i][0].Val(),
+			Scheduled: cmds[i][1].Val(),
+			Active:    cmds[i][2].Val(),
+			Dead:      cmds[i][3].Val(),
+		}
+	}
+	return stats, nil
+}
+
+// List returns up to limit jobs of queue in state, in processing order.
+func (q *JobQueue) List(ctx context.Context, queue, state string, offset, limit int64) ([]*Job, error) {
+	switch state {
+	case JobQueued, JobScheduled, JobActive, JobDead:
+	default:
+		return nil, fmt.Errorf("invalid job state %q", state)
+	}
+	ids, err := q.Redis.ZRange(ctx, q.stateKey(queue, state), offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([]*redis.StringStringMapCmd, len(ids))
+	_, err = q.Redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, q.jobKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(ids))
+	for _, cmd := range cmds {
+		if fields := cmd.Val(); len(fields) > 0 {
+			jobs = append(jobs, parseJob(fields))
+		}
+	}
+	return jobs, nil
+}
+
+// runCron enqueues cron entries as they come due. A Redis key per tick makes
+// sure only one replica enqueues it.
+func (q *JobQueue) runCron(ctx context.Context) {
+	q.mu.RLock()
+	crons := append([]cronJob(nil), q.crons...)
+	q.mu.RUnlock()
+	if len(crons) == 0 {
+		return
+	}
+
+	next := make([]time.Time, len(crons))
+	for i, c := range crons {
+		next[i] = c.schedule.Next(time.Now())
+	}
+	for {
+		earliest := 0
+		for i := range next {
+			if next[i].Before(next[earliest]) {
+				earliest = i
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next[earliest])):
+		}
+
+		c, tick := crons[earliest], next[earliest]
+		next[earliest] = c.schedule.Next(tick)
+		sum := sha1.Sum([]byte(c.spec + "|" + c.jobType))
+		guard := q.Prefix + ":cron:" + hex.EncodeToString(sum[:]) + ":" + strconv.FormatInt(tick.Unix(), 10)
+		ok, err := q.Redis.SetNX(ctx, guard, 1, 24*time.Hour).Result()
+		if err != nil {
+			log.Printf("[Jobs] Erro ao agendar cron %s: %v", c.spec, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if _, err := q.Enqueue(ctx, c.jobType, c.payload, c.opts); err != nil && !errors.Is(err, ErrJobExists) {
+			log.Printf("[Jobs] Erro ao enfileirar cron %s: %v", c.spec, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package gorote
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Admin registers JSON routes to inspect and manage jobs on router:
+//
+//	GET    /queues                 stats of every queue
+//	GET    /queues/:queue/:state   jobs in a state (?offset=&limit=)
+//	GET    /jobs/:id               a single job
+//	POST   /jobs/:id/retry         run a scheduled or dead job now
+//	DELETE /jobs/:id               delete a job
+//
+// Protect router with an authentication middleware such as JWTProtected.
+func (q *JobQueue) Admin(router fiber.Router) {
+	router.Get("/queues", func(ctx *fiber.Ctx) error {
+		stats, err := q.Stats(ctx.UserContext())
+		if err != nil {
+			return err
+		}
+		return ctx.JSON(stats)
+	})
+
+	router.Get("/queues/:queue/:state", func(ctx *fiber.Ctx) error {
+		offset := ctx.QueryInt("offset", 0)
+		limit := ctx.QueryInt("limit", 50)
+		if offset < 0 || limit <= 0 || limit > 1000 {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid offset or limit")
+		}
+		jobs, err := q.List(ctx.UserContext(), ctx.Params("queue"), ctx.Params("state"), int64(offset), int64(limit))
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return ctx.JSON(jobs)
+	})
+
+	router.Get("/jobs/:id", func(ctx *fiber.Ctx) error {
+		job, err := q.Get(ctx.UserContext(), ctx.Params("id"))
+		if err != nil {
+			return jobAdminError(err)
+		}
+		return ctx.JSON(job)
+	})
+
+	router.Post("/jobs/:id/retry", func(ctx *fiber.Ctx) error {
+		if err := q.Retry(ctx.UserContext(), ctx.Params("id")); err != nil {
+			return jobAdminError(err)
+		}
+		return ctx.SendStatus(fiber.StatusNoContent)
+	})
+
+	router.Delete("/jobs/:id", func(ctx *fiber.Ctx) error {
+		if err := q.Delete(ctx.UserContext(), ctx.Params("id")); err != nil {
+			return jobAdminError(err)
+		}
+		return ctx.SendStatus(fiber.StatusNoContent)
+	})
+}
+
+func jobAdminError(err error) error {
+	if errors.Is(err, ErrJobNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+)
+
+func newTestJobQueue(t *testing.T) *JobQueue {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	q := NewJobQueue(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	q.PollInterval = 10 * time.Millisecond
+	q.BaseBackoff = time.Millisecond
+	return q
+}
+
+type emailJob struct {
+	To string `json:"to"`
+}
+
+func TestJobQueuePriority(t *testing.T) {
+	q := newTestJobQueue(t)
+	ctx := context.Background()
+
+	for _, job := range []struct {
+		to       string
+		priority int
+	}{{"baixa", -10}, {"normal", 0}, {"alta", 10}, {"normal2", 0}} {
+		if _, err := q.Enqueue(ctx, "email", emailJob{To: job.to}, JobOptions{Priority: job.priority}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	var order []string
+	for {
+		job, err := q.dequeue(ctx, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job == nil {
+			break
+		}
+		var payload emailJob
+		job.Decode(&payload)
+		order = append(order, payload.To)
+	}
+	if got, _ := json.Marshal(order); string(got) != `["alta","normal","normal2","baixa"]` {
+		t.Errorf("ordem inesperada: %s", got)
+	}
+}
+
+func TestJobQueueRetries(t *testing.T) {
+	q := newTestJobQueue(t)
+	ctx := context.Background()
+	calls := 0
+	q.Register("email", HandleJob(func(ctx context.Context, e emailJob) error {
+		calls++
+		return errors.New("smtp indisponível")
+	}))
+
+	id, err := q.Enqueue(ctx, "email", emailJob{To: "a@b.c"}, JobOptions{MaxAttempts: 2, UniqueKey: "email:a@b.c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dup, err := q.Enqueue(ctx, "email", emailJob{To: "a@b.c"}, JobOptions{UniqueKey: "email:a@b.c"}); !errors.Is(err, ErrJobExists) || dup != id {
+		t.Fatalf("esperava ErrJobExists com o id %s, recebeu %s %v", id, dup, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		time.Sleep(5 * time.Millisecond)
+		if err := q.promoteDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+		job, err := q.dequeue(ctx, "default")
+		if err != nil || job == nil {
+			t.Fatalf("esperava job na tentativa %d: %v", i+1, err)
+		}
+		q.process(ctx, job)
+	}
+
+	job, err := q.Get(ctx, id)
+	if err != nil || job.Status != JobDead || job.Attempts != 2 || job.LastError != "smtp indisponível" || calls != 2 {
+		t.Fatalf("esperava job morto após 2 tentativas: %+v %v (chamadas %d)", job, err, calls)
+	}
+	if _, err := q.Enqueue(ctx, "email", emailJob{To: "a@b.c"}, JobOptions{UniqueKey: "email:a@b.c"}); err != nil {
+		t.Errorf("chave única deveria ser liberada após o job morrer: %v", err)
+	}
+
+	if err := q.Retry(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := q.Get(ctx, id); job.Status != JobQueued || job.Attempts != 0 {
+		t.Errorf("esperava job reenfileirado: %+v", job)
+	}
+}
+
+func TestJobQueueRunAndAdmin(t *testing.T) {
+	q := newTestJobQueue(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan string, 1)
+	q.Register("email", HandleJob(func(ctx context.Context, e emailJob) error {
+		done <- e.To
+		return nil
+	}))
+	if _, err := q.Enqueue(ctx, "email", emailJob{To: "agendado"}, JobOptions{Delay: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(finished)
+	}()
+	select {
+	case to := <-done:
+		if to != "agendado" {
+			t.Errorf("payload inesperado: %s", to)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job agendado não executado")
+	}
+	cancel()
+	<-finished
+
+	app := fiber.New()
+	q.Admin(app.Group("/admin"))
+	resp, err := app.Test(httptest.NewRequest("GET", "/admin/queues", nil))
+	if err != nil || resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("erro na rota de filas: %v %v", resp, err)
+	}
+	var stats []JobQueueStats
+	json.NewDecoder(resp.Body).Decode(&stats)
+	if len(stats) != 1 || stats[0].Queue != "default" || stats[0].Queued+stats[0].Scheduled+stats[0].Active != 0 {
+		t.Errorf("estatísticas inesperadas: %+v", stats)
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/admin/jobs/inexistente", nil))
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("esperava 404, recebeu %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,146 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/robfig/cron/v3"
+)
+
+// LeaderElection elects a single leader among the replicas sharing Key. The
+// leader holds a RedisLock on Key; the others retry every RetryInterval and
+// take over once the lease is released or expires.
+type LeaderElection struct {
+	Redis         *redis.Client
+	Key           string
+	TTL           time.Duration
+	RetryInterval time.Duration
+	// OnElected runs when this replica becomes leader. ctx is cancelled when
+	// leadership is lost or Run returns.
+	OnElected func(ctx context.Context)
+	// OnRevoked runs when this replica stops being leader.
+	OnRevoked func()
+
+	mu        sync.RWMutex
+	leaderCtx context.Context
+}
+
+func NewLeaderElection(client *redis.Client, key string) *LeaderElection {
+	return &LeaderElection{
+		Redis:         client,
+		Key:           key,
+		TTL:           15 * time.Second,
+		RetryInterval: 5 * time.Second,
+	}
+}
+
+// IsLeader reports whether this replica currently holds leadership.
+func (e *LeaderElection) IsLeader() bool {
+	return e.LeaderContext() != nil
+}
+
+// LeaderContext returns a context cancelled when leadership is lost, or nil
+// when this replica is not the leader.
+func (e *LeaderElection) LeaderContext() context.Context {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.leaderCtx == nil || e.leaderCtx.Err() != nil {
+		return nil
+	}
+	return e.leaderCtx
+}
+
+// Run takes part in the election until ctx is cancelled, releasing
+// leadership on the way out.
+func (e *LeaderElection) Run(ctx context.Context) error {
+	for {
+		lock, err := ObtainLock(ctx, e.Redis, e.Key, e.TTL, e.RetryInterval)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("[Redis] Erro na eleição de líder %s: %v", e.Key, err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(e.RetryInterval):
+			}
+			continue
+		}
+
+		e.lead(ctx, lock)
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// lead holds leadership until lock is lost or ctx is cancelled.
+func (e *LeaderElection) lead(ctx context.Context, lock *RedisLock) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(lock.Context(), cancel)
+	defer stop()
+
+	e.mu.Lock()
+	e.leaderCtx = leaderCtx
+	e.mu.Unlock()
+	log.Printf("[Redis] Eleito líder de %s", e.Key)
+
+	var wg sync.WaitGroup
+	if e.OnElected != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.OnElected(leaderCtx)
+		}()
+	}
+	<-leaderCtx.Done()
+
+	e.mu.Lock()
+	e.leaderCtx = nil
+	e.mu.Unlock()
+	if err := lock.Release(context.WithoutCancel(ctx)); err != nil && !errors.Is(err, ErrLockLost) {
+		log.Printf("[Redis] Erro ao liberar liderança de %s: %v", e.Key, err)
+	}
+	wg.Wait()
+	log.Printf("[Redis] Liderança de %s encerrada", e.Key)
+	if e.OnRevoked != nil {
+		e.OnRevoked()
+	}
+}
+
+// LeaderCron runs cron jobs only on the leader of Election, so singleton
+// tasks fire once across replicas. Jobs receive the leader context, which is
+// cancelled if leadership is lost mid-run.
+type LeaderCron struct {
+	Election *LeaderElection
+	cron     *cron.Cron
+}
+
+func NewLeaderCron(election *LeaderElection) *LeaderCron {
+	return &LeaderCron{Election: election, cron: cron.New()}
+}
+
+// Add schedules fn with a standard cron expression or a descriptor such as
+// "@every 1m".
+func (c *LeaderCron) Add(spec string, fn func(ctx context.Context)) error {
+	_, err := c.cron.AddFunc(spec, func() {
+		if ctx := c.Election.LeaderContext(); ctx != nil {
+			fn(ctx)
+		}
+	})
+	return err
+}
+
+// Run takes part in the election and runs the scheduler until ctx is
+// cancelled, then waits for running jobs.
+func (c *LeaderCron) Run(ctx context.Context) error {
+	c.cron.Start()
+	err := c.Election.Run(ctx)
+	<-c.cron.Stop().Done()
+	return err
+}
@@ -0,0 +1,76 @@
+package gorote
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	val []byte
+	exp time.Time
+}
+
+// MemoryStorage is an in-process fiber.Storage with per-key expiration.
+// Expired keys are dropped on access and swept at most once a minute on
+// writes.
+type MemoryStorage struct {
+	mu        sync.RWMutex
+	data      map[string]memoryEntry
+	lastSweep time.Time
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{data: make(map[string]memoryEntry), lastSweep: time.Now()}
+}
+
+func (s *MemoryStorage) Get(key string) ([]byte, error) {
+	s.mu.RLock()
+	e, ok := s.data[key]
+	s.mu.RUnlock()
+	if !ok || (!e.exp.IsZero() && time.Now().After(e.exp)) {
+		return nil, nil
+	}
+	return e.val, nil
+}
+
+func (s *MemoryStorage) Set(key string, val []byte, exp time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+	now := time.Now()
+	e := memoryEntry{val: append([]byte(nil), val...)}
+	if exp > 0 {
+		e.exp = now.Add(exp)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = e
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, e := range s.data {
+			if !e.exp.IsZero() && now.After(e.exp) {
+				delete(s.data, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *MemoryStorage) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = make(map[string]memoryEntry)
+	return nil
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
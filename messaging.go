@@ -0,0 +1,386 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	messageIDAttribute = "message_id"
+	// maxAttributesSQS is the number of message attributes SQS accepts.
+	maxAttributesSQS = 10
+)
+
+var ErrMessageSettled = errors.New("message already acked or nacked")
+
+// Message is the broker-agnostic envelope exchanged by Publisher and Subscriber.
+type Message struct {
+	ID       string
+	Headers  map[string]string
+	Body     []byte
+	Attempts int
+
+	mu      sync.Mutex
+	settled bool
+	ack     func() error
+	nack    func(requeue bool) error
+}
+
+// NewMessage builds a Message with a fresh ID and data serialized as JSON.
+func NewMessage(data any) (*Message, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize struct: %w", err)
+	}
+	return &Message{ID: uuid.NewString(), Headers: map[string]string{}, Body: body}, nil
+}
+
+func (m *Message) Decode(v any) error {
+	return json.Unmarshal(m.Body, v)
+}
+
+// Ack confirms the message was processed and removes it from the broker.
+func (m *Message) Ack() error {
+	return m.settle(func() error { return m.ack() })
+}
+
+// Nack rejects the message. With requeue it is made available again right
+// away; otherwise the broker's dead-letter policy applies.
+func (m *Message) Nack(requeue bool) error {
+	return m.settle(func() error { return m.nack(requeue) })
+}
+
+func (m *Message) settle(f func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.settled {
+		return ErrMessageSettled
+	}
+	m.settled = true
+	return f()
+}
+
+func (m *Message) isSettled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.settled
+}
+
+type MessageHandler func(ctx context.Context, msg *Message) error
+
+type MessageMiddleware func(MessageHandler) MessageHandler
+
+// ChainMessage wraps handler with middlewares; the first one is the outermost.
+func ChainMessage(handler MessageHandler, middlewares ...MessageMiddleware) MessageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, topic string, msg *Message) error
+}
+
+// Subscriber delivers messages from topic to handler until ctx is cancelled.
+// Messages the handler leaves unsettled are acked when it returns nil and
+// nacked when it returns an error; each broker documents whether that nack
+// requeues.
+type Subscriber interface {
+	Subscribe(ctx context.Context, topic string, handler MessageHandler) error
+}
+
+type Broker interface {
+	Publisher
+	Subscriber
+}
+
+// dispatchMessage runs handler and settles msg if the handler did not, nacking
+// with requeue on error. done, when set, receives the handler result before
+// settlement.
+func dispatchMessage(ctx context.Context, msg *Message, handler MessageHandler, requeue bool, done func(error)) {
+	err := handler(ctx, msg)
+	if done != nil {
+		done(err)
+	}
+	if msg.isSettled() {
+		return
+	}
+	if err != nil {
+		log.Printf("[Messaging] Erro no handler: %v", err)
+		if err := msg.Nack(requeue); err != nil {
+			log.Printf("[Messaging] Erro ao fazer NACK: %v", err)
+		}
+		return
+	}
+	if err := msg.Ack(); err != nil {
+		log.Printf("[Messaging] Erro ao fazer ACK: %v", err)
+	}
+}
+
+// RabbitMQBroker adapts ConnRabbitMQ to Broker. Topics are queue names.
+type RabbitMQBroker struct {
+	Conn         *ConnRabbitMQ
+	Worker       int
+	ConsumerName string
+	// DeadLetter nacks messages whose handler failed without requeue, routing
+	// them to the queue's dead-letter exchange. By default they are requeued
+	// and redelivered right away, since on a queue without a dead-letter
+	// exchange DeadLetter discards them.
+	DeadLetter bool
+}
+
+func NewRabbitMQBroker(conn *ConnRabbitMQ, worker int, consumerName string) *RabbitMQBroker {
+	return &RabbitMQBroker{Conn: conn, Worker: worker, ConsumerName: consumerName}
+}
+
+func (b *RabbitMQBroker) Publish(ctx context.Context, topic string, msg *Message) error {
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	err := b.Conn.Channel.PublishWithContext(ctx, "", topic, false, false, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    msg.ID,
+		Body:         msg.Body,
+		Timestamp:    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("falha ao publicar na fila: %w", err)
+	}
+	return nil
+}
+
+func (b *RabbitMQBroker) Subscribe(ctx context.Context, topic string, handler MessageHandler) error {
+	return b.Conn.consume(ctx, b.Worker, topic, b.ConsumerName, func(d amqp.Delivery) {
+		headers := make(map[string]string, len(d.Headers))
+		for k, v := range d.Headers {
+			headers[k] = fmt.Sprintf("%v", v)
+		}
+		attempts := Redelivery(d) + 1
+		if attempts == 1 && d.Redelivered {
+			attempts = 2
+		}
+		msg := &Message{
+			ID:       d.MessageId,
+			Headers:  headers,
+			Body:     d.Body,
+			Attempts: attempts,
+			ack: func() error {
+				err := d.Ack(false)
+				b.Conn.Metrics.ack(topic, err)
+				return err
+			},
+			nack: func(requeue bool) error {
+				b.Conn.Metrics.nack(topic)
+				return d.Nack(false, requeue)
+			},
+		}
+		done := b.Conn.Metrics.start(topic)
+		dispatchMessage(ctx, msg, handler, !b.DeadLetter, done)
+	})
+}
+
+// SQSBroker adapts ConnSQS to Broker. Topics are queue URLs and headers are
+// carried as string message attributes. The message ID takes one of the ten
+// attributes SQS allows, so messages may have at most nine headers.
+//
+// Messages are consumed like ConsumerMessages, so the connection Heartbeat and
+// Offload and Options.DeleteBatchSize apply. Nack without requeue, the default
+// when the handler fails, leaves the message to reappear after the visibility
+// timeout, so the queue redrive policy decides when it moves to the DLQ.
+type SQSBroker struct {
+	Conn   ConnSQS
+	Worker int
+	// Options configures the consumer; QueueURL comes from the topic and
+	// Workers from Worker when set.
+	Options ConsumerOptionsSQS
+	// Requeue makes messages whose handler failed visible again right away
+	// instead of after the visibility timeout.
+	Requeue bool
+}
+
+func NewSQSBroker(conn ConnSQS, worker int) *SQSBroker {
+	return &SQSBroker{Conn: conn, Worker: worker}
+}
+
+func (b *SQSBroker) Publish(ctx context.Context, topic string, msg *Message) error {
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+	if _, ok := msg.Headers[messageIDAttribute]; ok {
+		return fmt.Errorf("header %s is reserved for the message ID", messageIDAttribute)
+	}
+	if len(msg.Headers) >= maxAttributesSQS {
+		return fmt.Errorf("message has %d headers, SQS allows at most %d besides the message ID", len(msg.Headers), maxAttributesSQS-1)
+	}
+	attributes := map[string]types.MessageAttributeValue{
+		messageIDAttribute: {DataType: aws.String("String"), StringValue: aws.String(msg.ID)},
+	}
+	for k, v := range msg.Headers {
+		attributes[k] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+	}
+	_, err := b.Conn.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(topic),
+		MessageBody:       aws.String(string(msg.Body)),
+		MessageAttributes: attributes,
+	})
+	if err != nil {
+		return fmt.Errorf("falha ao enviar mensagem para a fila: %w", err)
+	}
+	return nil
+}
+
+// errMessageNacked tells the SQS consumer not to delete a nacked message.
+var errMessageNacked = errors.New("message nacked")
+
+func (b *SQSBroker) Subscribe(ctx context.Context, topic string, handler MessageHandler) error {
+	opts := b.Options
+	opts.QueueURL = topic
+	if b.Worker > 0 {
+		opts.Workers = b.Worker
+	}
+	opts.MessageAttributeNames = []string{"All"}
+	opts.AttributeNames = append([]types.MessageSystemAttributeName{types.MessageSystemAttributeNameApproximateReceiveCount}, opts.AttributeNames...)
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return err
+	}
+	handle, stop := b.Conn.messageHandler(ctx, opts, func(ctx context.Context, m types.Message) error {
+		headers := make(map[string]string, len(m.MessageAttributes))
+		for k, v := range m.MessageAttributes {
+			if v.StringValue != nil {
+				headers[k] = *v.StringValue
+			}
+		}
+		id := headers[messageIDAttribute]
+		delete(headers, messageIDAttribute)
+		if id == "" {
+			id = aws.ToString(m.MessageId)
+		}
+		attempts, _ := strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+
+		// The consumer deletes the message once this handler returns nil, so
+		// ack only records the outcome.
+		acked := false
+		msg := &Message{
+			ID:       id,
+			Headers:  headers,
+			Body:     []byte(aws.ToString(m.Body)),
+			Attempts: attempts,
+			ack: func() error {
+				acked = true
+				return nil
+			},
+			nack: func(requeue bool) error {
+				b.Conn.Metrics.nack(topic)
+				if !requeue {
+					return nil
+				}
+				_, err := b.Conn.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          aws.String(topic),
+					ReceiptHandle:     m.ReceiptHandle,
+					VisibilityTimeout: 0,
+				})
+				return err
+			},
+		}
+		dispatchMessage(ctx, msg, handler, b.Requeue, nil)
+		if !acked {
+			return errMessageNacked
+		}
+		return nil
+	})
+	defer stop()
+
+	return b.Conn.receive(ctx, opts, func(ctx context.Context, m types.Message) {
+		handle(ctx, m)
+	})
+}
+
+// MemoryBroker is an in-process Broker intended for tests. Each topic is a
+// buffered channel; nacked messages with requeue go back to the topic.
+type MemoryBroker struct {
+	Buffer int
+
+	mu     sync.Mutex
+	topics map[string]chan *Message
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{Buffer: 1024, topics: make(map[string]chan *Message)}
+}
+
+func (b *MemoryBroker) topic(name string) chan *Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch, ok := b.topics[name]
+	if !ok {
+		ch = make(chan *Message, b.Buffer)
+		b.topics[name] = ch
+	}
+	return ch
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, msg *Message) error {
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+	headers := make(map[string]string, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case b.topic(topic) <- &Message{ID: msg.ID, Headers: headers, Body: msg.Body}:
+		return nil
+	}
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, topic string, handler MessageHandler) error {
+	ch := b.topic(topic)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case queued := <-ch:
+			msg := &Message{
+				ID:       queued.ID,
+				Headers:  queued.Headers,
+				Body:     queued.Body,
+				Attempts: queued.Attempts + 1,
+			}
+			msg.ack = func() error { return nil }
+			msg.nack = func(requeue bool) error {
+				if requeue {
+					go func() { ch <- &Message{ID: msg.ID, Headers: msg.Headers, Body: msg.Body, Attempts: msg.Attempts} }()
+				}
+				return nil
+			}
+			dispatchMessage(ctx, msg, handler, true, nil)
+		}
+	}
+}
+
+// Pending returns how many messages are waiting on topic.
+func (b *MemoryBroker) Pending(topic string) int {
+	return len(b.topic(topic))
+}
@@ -0,0 +1,242 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	t.Run("entrega e faz ack automático", func(t *testing.T) {
+		broker := NewMemoryBroker()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		msg, err := NewMessage(map[string]string{"order": "42"})
+		if err != nil {
+			t.Fatalf("erro ao criar mensagem: %v", err)
+		}
+		msg.Headers["tenant"] = "acme"
+		if err := broker.Publish(ctx, "orders", msg); err != nil {
+			t.Fatalf("erro ao publicar: %v", err)
+		}
+
+		received := make(chan *Message, 1)
+		go broker.Subscribe(ctx, "orders", func(ctx context.Context, m *Message) error {
+			received <- m
+			return nil
+		})
+
+		select {
+		case m := <-received:
+			var body map[string]string
+			if err := m.Decode(&body); err != nil || body["order"] != "42" {
+				t.Errorf("corpo inesperado: %v (%v)", body, err)
+			}
+			if m.ID != msg.ID || m.Headers["tenant"] != "acme" || m.Attempts != 1 {
+				t.Errorf("envelope inesperado: %+v", m)
+			}
+		case <-ctx.Done():
+			t.Fatal("mensagem não foi entregue")
+		}
+	})
+
+	t.Run("reentrega após erro no handler", func(t *testing.T) {
+		broker := NewMemoryBroker()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		msg, _ := NewMessage("retry")
+		if err := broker.Publish(ctx, "jobs", msg); err != nil {
+			t.Fatalf("erro ao publicar: %v", err)
+		}
+
+		attempts := make(chan int, 3)
+		go broker.Subscribe(ctx, "jobs", func(ctx context.Context, m *Message) error {
+			attempts <- m.Attempts
+			if m.Attempts < 2 {
+				return errors.New("falha temporária")
+			}
+			return nil
+		})
+
+		for want := 1; want <= 2; want++ {
+			select {
+			case got := <-attempts:
+				if got != want {
+					t.Errorf("esperava tentativa %d, recebeu %d", want, got)
+				}
+			case <-ctx.Done():
+				t.Fatalf("tentativa %d não foi entregue", want)
+			}
+		}
+	})
+
+	t.Run("nack sem requeue descarta", func(t *testing.T) {
+		broker := NewMemoryBroker()
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		msg, _ := NewMessage("drop")
+		broker.Publish(ctx, "drop", msg)
+
+		done := make(chan struct{})
+		go broker.Subscribe(ctx, "drop", func(ctx context.Context, m *Message) error {
+			if err := m.Nack(false); err != nil {
+				t.Errorf("erro no nack: %v", err)
+			}
+			if err := m.Ack(); !errors.Is(err, ErrMessageSettled) {
+				t.Errorf("esperava ErrMessageSettled, recebeu %v", err)
+			}
+			close(done)
+			return nil
+		})
+		<-done
+		if n := broker.Pending("drop"); n != 0 {
+			t.Errorf("esperava fila vazia, restaram %d", n)
+		}
+	})
+}
+
+func TestChainMessage(t *testing.T) {
+	var order []string
+	mw := func(name string) MessageMiddleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(ctx context.Context, m *Message) error {
+				order = append(order, name)
+				return next(ctx, m)
+			}
+		}
+	}
+	handler := ChainMessage(func(ctx context.Context, m *Message) error {
+		order = append(order, "handler")
+		return nil
+	}, mw("a"), mw("b"))
+
+	handler(context.Background(), &Message{})
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "handler" {
+		t.Errorf("ordem inesperada: %v", order)
+	}
+}
+
+func TestSQSBroker(t *testing.T) {
+	conn, srv := newTestSQS(t)
+	queueURL := srv.CreateQueue("eventos", nil)
+	broker := NewSQSBroker(*conn, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("preserva id e headers", func(t *testing.T) {
+		msg, _ := NewMessage(map[string]string{"order": "42"})
+		msg.Headers["tenant"] = "acme"
+		if err := broker.Publish(ctx, queueURL, msg); err != nil {
+			t.Fatal(err)
+		}
+		received := make(chan *Message, 1)
+		subCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go broker.Subscribe(subCtx, queueURL, func(ctx context.Context, m *Message) error {
+			received <- m
+			return nil
+		})
+		select {
+		case m := <-received:
+			if m.ID != msg.ID || m.Headers["tenant"] != "acme" || len(m.Headers) != 1 {
+				t.Errorf("envelope inesperado: %+v", m)
+			}
+		case <-ctx.Done():
+			t.Fatal("mensagem não recebida")
+		}
+	})
+
+	t.Run("erro no handler espera o visibility timeout", func(t *testing.T) {
+		queueURL := srv.CreateQueue("falhas", nil)
+		msg, _ := NewMessage("x")
+		if err := broker.Publish(ctx, queueURL, msg); err != nil {
+			t.Fatal(err)
+		}
+		attempts := make(chan int, 2)
+		subCtx, stop := context.WithTimeout(ctx, 300*time.Millisecond)
+		defer stop()
+		broker.Subscribe(subCtx, queueURL, func(ctx context.Context, m *Message) error {
+			attempts <- m.Attempts
+			return errors.New("falhou")
+		})
+		if len(attempts) != 1 || srv.Len("falhas") != 1 {
+			t.Errorf("esperava uma entrega e a mensagem na fila, recebeu %d entregas e %d mensagens", len(attempts), srv.Len("falhas"))
+		}
+	})
+
+	t.Run("requeue devolve a mensagem na hora", func(t *testing.T) {
+		queueURL := srv.CreateQueue("requeue", nil)
+		msg, _ := NewMessage("x")
+		if err := broker.Publish(ctx, queueURL, msg); err != nil {
+			t.Fatal(err)
+		}
+		requeue := NewSQSBroker(*conn, 1)
+		requeue.Requeue = true
+		subCtx, stop := context.WithTimeout(ctx, 2*time.Second)
+		defer stop()
+		go func() {
+			for srv.Len("requeue") > 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+			stop()
+		}()
+		attempts := 0
+		requeue.Subscribe(subCtx, queueURL, func(ctx context.Context, m *Message) error {
+			attempts = m.Attempts
+			if m.Attempts < 2 {
+				return errors.New("falhou")
+			}
+			return nil
+		})
+		if n := srv.Len("requeue"); n != 0 || attempts != 2 {
+			t.Errorf("mensagem deveria ter sido removida na segunda entrega, restam %d após %d entregas", n, attempts)
+		}
+	})
+
+	t.Run("remoção em lote", func(t *testing.T) {
+		queueURL := srv.CreateQueue("lote", nil)
+		batched := NewSQSBroker(*conn, 2)
+		batched.Options = ConsumerOptionsSQS{DeleteBatchSize: 10, DeleteInterval: time.Hour, WaitTime: time.Second}
+		for i := 0; i < 3; i++ {
+			msg, _ := NewMessage(i)
+			if err := batched.Publish(ctx, queueURL, msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		subCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		received := make(chan struct{}, 3)
+		go func() {
+			for i := 0; i < 3; i++ {
+				<-received
+			}
+			stop()
+		}()
+		batched.Subscribe(subCtx, queueURL, func(ctx context.Context, m *Message) error {
+			received <- struct{}{}
+			return nil
+		})
+		if n := srv.Len("lote"); n != 0 {
+			t.Errorf("remoções pendentes deveriam sair no encerramento, restam %d", n)
+		}
+	})
+
+	t.Run("rejeita headers além do limite do SQS", func(t *testing.T) {
+		msg, _ := NewMessage("x")
+		for i := 0; i < 10; i++ {
+			msg.Headers[fmt.Sprintf("h%d", i)] = "v"
+		}
+		if err := broker.Publish(ctx, queueURL, msg); err == nil {
+			t.Error("esperava erro com 10 headers")
+		}
+		msg.Headers = map[string]string{messageIDAttribute: "outro"}
+		if err := broker.Publish(ctx, queueURL, msg); err == nil {
+			t.Error("esperava erro com header reservado")
+		}
+	})
+}
@@ -10,7 +10,6 @@ import (
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cache"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -23,6 +22,8 @@ type parseInfo struct {
 	hasForm   bool
 }
 
+// Check always responds OK. HealthRegistry adds readiness checks of the
+// backing services.
 func Check() fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusOK).JSON(map[string]string{"status": "OK"})
@@ -161,19 +162,37 @@ func parseFormFields(ctx *fiber.Ctx, instance any) {
 	}
 }
 
-func Cached(ttl time.Duration) func(ctx *fiber.Ctx) error {
+// Cached caches responses for ttl. An optional storage, such as
+// NewRedisStorage, shares the cache across replicas; the default is in memory.
+// Responses are keyed by path only, so use NewResponseCache for authenticated
+// routes, tag invalidation or stale-while-revalidate.
+func Cached(ttl time.Duration, storage ...fiber.Storage) func(ctx *fiber.Ctx) error {
 	config := cache.Config{
 		Expiration: ttl,
 	}
+	if len(storage) > 0 {
+		config.Storage = storage[0]
+	}
 	return cache.New(config)
 }
 
-func Limited(max int) func(c *fiber.Ctx) error {
-	config := limiter.Config{
-		Max: max,
-		LimitReached: func(c *fiber.Ctx) error {
-			return fiber.ErrTooManyRequests
-		},
+// Limited allows max requests per minute per IP, in fixed windows. An optional
+// storage, such as NewRedisStorage, shares the counters across replicas; the
+// default is in memory. It is RateLimit with those settings, so a RedisStorage
+// is updated atomically; use RateLimit directly for custom keys, algorithms
+// and per-plan limits.
+func Limited(max int, storage ...fiber.Storage) func(c *fiber.Ctx) error {
+	if max <= 0 {
+		max = 5
+	}
+	config := RateLimitConfig{
+		Max:       max,
+		Window:    time.Minute,
+		Algorithm: RateLimitFixedWindow,
+		Key:       KeyByIP(),
+	}
+	if len(storage) > 0 {
+		config.Storage = storage[0]
 	}
-	return limiter.New(config)
+	return RateLimit(config)
 }
@@ -0,0 +1,282 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// OutboxMessage is a message waiting to be published. Rows are written in the
+// same transaction as the domain changes and published later by OutboxRelay.
+type OutboxMessage struct {
+	ID            uint64    `gorm:"primaryKey;autoIncrement"`
+	MessageID     string    `gorm:"size:36;uniqueIndex;not null"`
+	Destination   string    `gorm:"size:512;not null"`
+	Payload       []byte    `gorm:"not null"`
+	Status        string    `gorm:"size:16;not null;index:idx_outbox_status_next"`
+	Attempts      int       `gorm:"not null;default:0"`
+	NextAttemptAt time.Time `gorm:"not null;index:idx_outbox_status_next"`
+	LastError     string
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox_messages"
+}
+
+// OutboxPublisher delivers an outbox message to its destination.
+type OutboxPublisher func(ctx context.Context, msg OutboxMessage) error
+
+// EnqueueOutbox stores data for publication to destination (a RabbitMQ queue
+// or an SQS queue URL). Call it with the transaction used for domain writes so
+// the message is only published if the transaction commits.
+func EnqueueOutbox(tx *gorm.DB, destination string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize struct: %w", err)
+	}
+	msg := OutboxMessage{
+		MessageID:     uuid.NewString(),
+		Destination:   destination,
+		Payload:       payload,
+		Status:        OutboxPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := tx.Create(&msg).Error; err != nil {
+		return fmt.Errorf("failed to enqueue outbox message: %w", err)
+	}
+	return nil
+}
+
+// OutboxPublisher publishes on a dedicated channel in confirm mode and only
+// reports success once the broker acks the message, so a nack, a broker crash
+// or a confirmation slower than confirmTimeout leaves the row pending for a
+// retry. Messages are mandatory: a destination queue that does not exist
+// fails with ErrUnroutable instead of the message being dropped.
+func (r *ConnRabbitMQ) OutboxPublisher() OutboxPublisher {
+	const confirmTimeout = 10 * time.Second
+	var mu sync.Mutex
+	var ch *confirmedChannel
+	return func(ctx context.Context, msg OutboxMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if ch == nil || ch.IsClosed() {
+			var err error
+			if ch, err = r.confirmChannel(); err != nil {
+				return err
+			}
+		}
+		ctx, cancel := context.WithTimeout(ctx, confirmTimeout)
+		defer cancel()
+		return ch.publish(ctx, msg.Destination, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    msg.MessageID,
+			Body:         msg.Payload,
+			Timestamp:    time.Now(),
+		})
+	}
+}
+
+// ErrUnroutable is returned when the broker gives back a mandatory message
+// because no queue matches its routing key.
+var ErrUnroutable = errors.New("message returned by the broker as unroutable")
+
+// confirmedChannel is a channel in confirm mode whose publish sets mandatory,
+// so a message no queue accepts fails instead of being confirmed and dropped.
+// It must not publish concurrently.
+type confirmedChannel struct {
+	*amqp.Channel
+	returns chan amqp.Return
+}
+
+// confirmChannel opens a channel in confirm mode.
+func (r *ConnRabbitMQ) confirmChannel() (*confirmedChannel, error) {
+	ch, err := r.Connection.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("falha ao abrir canal: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("falha ao ativar confirmações: %w", err)
+	}
+	return &confirmedChannel{Channel: ch, returns: ch.NotifyReturn(make(chan amqp.Return, 1))}, nil
+}
+
+// publish sends msg to the default exchange with routing key queue and waits
+// for the broker to confirm it.
+func (c *confirmedChannel) publish(ctx context.Context, queue string, msg amqp.Publishing) error {
+	confirm, err := c.PublishWithDeferredConfirmWithContext(ctx, "", queue, true, false, msg)
+	if err != nil {
+		return fmt.Errorf("falha ao publicar mensagem %s: %w", msg.MessageId, err)
+	}
+	if err := waitConfirm(ctx, confirm, msg.MessageId); err != nil {
+		return err
+	}
+	return checkReturn(c.returns, msg.MessageId)
+}
+
+// checkReturn reports whether the message confirmed last was returned. The
+// broker sends the return before the confirm and the client delivers both in
+// order, so it is already in returns once the confirm arrived.
+func checkReturn(returns <-chan amqp.Return, id string) error {
+	select {
+	case ret := <-returns:
+		return fmt.Errorf("%w: mensagem %s devolvida pela fila %s: %s", ErrUnroutable, id, ret.RoutingKey, ret.ReplyText)
+	default:
+		return nil
+	}
+}
+
+// confirmation is implemented by *amqp.DeferredConfirmation.
+type confirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+func waitConfirm(ctx context.Context, confirm confirmation, id string) error {
+	ok, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("mensagem %s não confirmada pelo broker: %w", id, err)
+	}
+	if !ok {
+		return fmt.Errorf("mensagem %s rejeitada pelo broker", id)
+	}
+	return nil
+}
+
+// OutboxPublisher sends through ConnSQS.Send, so large payloads are offloaded
+// and the outbox message ID travels in the message_id attribute. On FIFO
+// queues every row goes to the same group, keeping the outbox order, and the
+// message ID deduplicates retries.
+func (s ConnSQS) OutboxPublisher() OutboxPublisher {
+	return func(ctx context.Context, msg OutboxMessage) error {
+		out := MessageSQS{
+			Body:       msg.Payload,
+			Attributes: map[string]string{messageIDAttribute: msg.MessageID},
+		}
+		if IsFIFOQueue(msg.Destination) {
+			out.GroupID = "outbox"
+			out.DeduplicationID = msg.MessageID
+		}
+		_, err := s.Send(ctx, msg.Destination, out)
+		return err
+	}
+}
+
+// OutboxRelay polls pending outbox messages and publishes them. On Postgres
+// rows are claimed with SELECT ... FOR UPDATE SKIP LOCKED, so several relays
+// can run side by side without publishing the same row twice.
+type OutboxRelay struct {
+	DB          *gorm.DB
+	Publish     OutboxPublisher
+	BatchSize   int
+	Interval    time.Duration
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func NewOutboxRelay(db *gorm.DB, publish OutboxPublisher) *OutboxRelay {
+	return &OutboxRelay{
+		DB:          db,
+		Publish:     publish,
+		BatchSize:   100,
+		Interval:    time.Second,
+		MaxAttempts: 10,
+		BaseBackoff: time.Second,
+		MaxBackoff:  5 * time.Minute,
+	}
+}
+
+func (o *OutboxRelay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+	for {
+		n, err := o.RelayBatch(ctx)
+		if err != nil {
+			log.Printf("[Outbox] Erro ao publicar mensagens: %v", err)
+		}
+		if err == nil && n == o.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch publishes up to BatchSize due messages and returns how many rows
+// were processed.
+func (o *OutboxRelay) RelayBatch(ctx context.Context) (int, error) {
+	var processed int
+	err := o.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var msgs []OutboxMessage
+		if err := o.claim(tx, tx.Dialector.Name() == "postgres").Find(&msgs).Error; err != nil {
+			return err
+		}
+
+		for _, msg := range msgs {
+			updates := map[string]any{"attempts": msg.Attempts + 1}
+			if err := o.Publish(ctx, msg); err != nil {
+				updates["last_error"] = err.Error()
+				if msg.Attempts+1 >= o.MaxAttempts {
+					updates["status"] = OutboxFailed
+				} else {
+					updates["next_attempt_at"] = time.Now().Add(backoffDelay(msg.Attempts, o.BaseBackoff, o.MaxBackoff))
+				}
+			} else {
+				now := time.Now()
+				updates["status"] = OutboxSent
+				updates["sent_at"] = &now
+			}
+			if err := tx.Model(&OutboxMessage{}).Where("id = ?", msg.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			processed++
+		}
+		return nil
+	})
+	return processed, err
+}
+
+// claim selects the due pending rows in order. With lock they are claimed
+// with FOR UPDATE SKIP LOCKED, so concurrent relays skip each other's rows.
+func (o *OutboxRelay) claim(tx *gorm.DB, lock bool) *gorm.DB {
+	query := tx.Where("status = ? AND next_attempt_at <= ?", OutboxPending, time.Now()).
+		Order("id").
+		Limit(o.BatchSize)
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+	}
+	return query
+}
+
+// backoffDelay returns base doubled attempt times, capped at max.
+func backoffDelay(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
@@ -0,0 +1,187 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils/tests"
+)
+
+type fakeConfirmation struct {
+	ack bool
+	err error
+}
+
+func (f fakeConfirmation) WaitContext(ctx context.Context) (bool, error) {
+	if f.err != nil {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	return f.ack, nil
+}
+
+func TestWaitConfirm(t *testing.T) {
+	if err := waitConfirm(context.Background(), fakeConfirmation{ack: true}, "1"); err != nil {
+		t.Errorf("ack não deveria falhar: %v", err)
+	}
+	if err := waitConfirm(context.Background(), fakeConfirmation{}, "1"); err == nil {
+		t.Error("nack deveria falhar")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := waitConfirm(ctx, fakeConfirmation{err: errors.New("sem resposta")}, "1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("esperava timeout, recebeu %v", err)
+	}
+}
+
+func TestOutboxPublisherRabbitMQ(t *testing.T) {
+	r := newTestRabbitMQ(t)
+	queue := testQueue(t, r)
+	publish := r.OutboxPublisher()
+
+	msg := OutboxMessage{MessageID: "outbox-1", Destination: queue, Payload: []byte(`{"id":1}`)}
+	if err := publish(context.Background(), msg); err != nil {
+		t.Fatalf("publicação confirmada não deveria falhar: %v", err)
+	}
+	d, ok, err := r.Channel.Get(queue, true)
+	if err != nil || !ok || d.MessageId != "outbox-1" {
+		t.Errorf("mensagem não chegou à fila: %v %v %+v", err, ok, d)
+	}
+
+	msg.Destination = queue + "-inexistente"
+	if err := publish(context.Background(), msg); !errors.Is(err, ErrUnroutable) {
+		t.Errorf("fila inexistente deveria falhar com ErrUnroutable, recebeu %v", err)
+	}
+}
+
+func TestOutboxPublisherSQS(t *testing.T) {
+	conn, srv := newTestSQS(t)
+	queueURL := srv.CreateQueue("eventos.fifo", map[string]string{"FifoQueue": "true"})
+	publish := conn.OutboxPublisher()
+
+	msg := OutboxMessage{MessageID: "outbox-1", Destination: queueURL, Payload: []byte(`{"id":1}`)}
+	if err := publish(context.Background(), msg); err != nil {
+		t.Fatalf("fila FIFO deveria aceitar a mensagem: %v", err)
+	}
+	out, err := conn.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(queueURL),
+		MessageAttributeNames: []string{"All"},
+	})
+	if err != nil || len(out.Messages) != 1 {
+		t.Fatalf("esperava uma mensagem, recebeu %v %v", out, err)
+	}
+	m := out.Messages[0]
+	if aws.ToString(m.Body) != `{"id":1}` || aws.ToString(m.MessageAttributes[messageIDAttribute].StringValue) != "outbox-1" {
+		t.Errorf("mensagem inesperada: %s %v", aws.ToString(m.Body), m.MessageAttributes)
+	}
+}
+
+func newTestOutboxDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("erro ao abrir sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&OutboxMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestOutboxRelay(t *testing.T) {
+	ctx := context.Background()
+	row := func(t *testing.T, db *gorm.DB) OutboxMessage {
+		var msg OutboxMessage
+		if err := db.First(&msg).Error; err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	t.Run("publica e marca como enviada", func(t *testing.T) {
+		db := newTestOutboxDB(t)
+		var published []string
+		relay := NewOutboxRelay(db, func(ctx context.Context, msg OutboxMessage) error {
+			published = append(published, string(msg.Payload))
+			return nil
+		})
+		EnqueueOutbox(db, "pedidos", map[string]int{"id": 1})
+		EnqueueOutbox(db, "pedidos", map[string]int{"id": 2})
+
+		if n, err := relay.RelayBatch(ctx); err != nil || n != 2 {
+			t.Fatalf("esperava 2 mensagens, recebeu %d %v", n, err)
+		}
+		if len(published) != 2 || published[0] != `{"id":1}` {
+			t.Errorf("publicação fora de ordem: %v", published)
+		}
+		if msg := row(t, db); msg.Status != OutboxSent || msg.SentAt == nil || msg.Attempts != 1 {
+			t.Errorf("linha deveria estar enviada, recebeu %+v", msg)
+		}
+		if n, _ := relay.RelayBatch(ctx); n != 0 {
+			t.Errorf("mensagens enviadas não deveriam ser publicadas de novo, recebeu %d", n)
+		}
+	})
+
+	t.Run("falha agenda nova tentativa com backoff", func(t *testing.T) {
+		db := newTestOutboxDB(t)
+		relay := NewOutboxRelay(db, func(context.Context, OutboxMessage) error {
+			return errors.New("broker fora")
+		})
+		EnqueueOutbox(db, "pedidos", 1)
+
+		before := time.Now()
+		relay.RelayBatch(ctx)
+		msg := row(t, db)
+		if msg.Status != OutboxPending || msg.Attempts != 1 || msg.LastError != "broker fora" {
+			t.Errorf("linha deveria continuar pendente, recebeu %+v", msg)
+		}
+		if wait := msg.NextAttemptAt.Sub(before); wait < relay.BaseBackoff || wait > relay.BaseBackoff+time.Second {
+			t.Errorf("próxima tentativa deveria ser em %s, recebeu %s", relay.BaseBackoff, wait)
+		}
+		if n, _ := relay.RelayBatch(ctx); n != 0 {
+			t.Errorf("mensagem não vencida não deveria ser publicada, recebeu %d", n)
+		}
+	})
+
+	t.Run("marca como falha após MaxAttempts", func(t *testing.T) {
+		db := newTestOutboxDB(t)
+		relay := NewOutboxRelay(db, func(context.Context, OutboxMessage) error {
+			return errors.New("broker fora")
+		})
+		relay.MaxAttempts = 2
+		EnqueueOutbox(db, "pedidos", 1)
+
+		for i := 0; i < 2; i++ {
+			db.Model(&OutboxMessage{}).Where("1 = 1").Update("next_attempt_at", time.Now().Add(-time.Second))
+			if n, err := relay.RelayBatch(ctx); err != nil || n != 1 {
+				t.Fatalf("tentativa %d: esperava 1 mensagem, recebeu %d %v", i+1, n, err)
+			}
+		}
+		if msg := row(t, db); msg.Status != OutboxFailed || msg.Attempts != 2 {
+			t.Errorf("linha deveria estar como falha, recebeu %+v", msg)
+		}
+	})
+
+	t.Run("postgres reivindica com SKIP LOCKED", func(t *testing.T) {
+		db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		relay := NewOutboxRelay(db, nil)
+		var msgs []OutboxMessage
+		stmt := relay.claim(db, true).Find(&msgs).Statement
+		if sql := stmt.SQL.String(); !strings.Contains(sql, "FOR UPDATE SKIP LOCKED") {
+			t.Errorf("consulta deveria travar as linhas: %s", sql)
+		}
+	})
+}
@@ -29,6 +29,7 @@ func (q *InitRabbitMQ) ConnString() string {
 type ConnRabbitMQ struct {
 	Channel    *amqp.Channel
 	Connection *amqp.Connection
+	Metrics    *ConsumerMetrics
 }
 
 func (r *InitRabbitMQ) ConnectRabbitMQ(conn *ConnRabbitMQ, vhost string, connectionName string) error {
@@ -72,6 +73,7 @@ func (r *InitRabbitMQ) ConnectRabbitMQ(conn *ConnRabbitMQ, vhost string, connect
 					time.Sleep(5 * time.Second)
 
 					if err := r.ConnectRabbitMQ(conn, vhost, connectionName); err == nil {
+						conn.Metrics.reconnect("")
 						log.Println("[RabbitMQ] reconectado com sucesso!")
 						break
 					}
@@ -92,7 +94,26 @@ func (r *InitRabbitMQ) ConnectRabbitMQ(conn *ConnRabbitMQ, vhost string, connect
 	}
 }
 
-func (r *ConnRabbitMQ) Consumer(ctx context.Context, worker int, queue, nameConsumer string, f func(delivery amqp.Delivery) error) error {
+func (r *ConnRabbitMQ) Consumer(ctx context.Context, worker int, queue, nameConsumer string, f HandlesRabbitMQ) error {
+	return r.consume(ctx, worker, queue, nameConsumer, func(msg amqp.Delivery) {
+		done := r.Metrics.start(queue)
+		err := f(msg)
+		done(err)
+		if err != nil {
+			log.Printf("[RabbitMQ] Erro no handler: %v", err)
+			return
+		}
+		err = msg.Ack(false)
+		r.Metrics.ack(queue, err)
+		if err != nil {
+			log.Printf("[RabbitMQ] Erro ao fazer ACK: %v", err)
+		}
+	})
+}
+
+// consume registers a consumer on queue and hands each delivery to handle,
+// which is responsible for acknowledging it.
+func (r *ConnRabbitMQ) consume(ctx context.Context, worker int, queue, nameConsumer string, handle func(amqp.Delivery)) error {
 	for {
 		select {
 		case <-ctx.Done():
@@ -113,15 +134,16 @@ func (r *ConnRabbitMQ) Consumer(ctx context.Context, worker int, queue, nameCons
 
 		log.Printf("[RabbitMQ] Consumer registrado com sucesso na fila %s", queue)
 
-		if err := r.processMessages(ctx, worker, msgs, f); err != nil {
+		if err := r.processMessages(ctx, worker, msgs, handle); err != nil {
 			log.Printf("[RabbitMQ] processMessages retornou erro: %v - reconectando...", err)
+			r.Metrics.reconnect(queue)
 		}
 
 		time.Sleep(2 * time.Second)
 	}
 }
 
-func (r *ConnRabbitMQ) processMessages(ctx context.Context, worker int, msgs <-chan amqp.Delivery, f func(delivery amqp.Delivery) error) error {
+func (r *ConnRabbitMQ) processMessages(ctx context.Context, worker int, msgs <-chan amqp.Delivery, handle func(amqp.Delivery)) error {
 	sem := make(chan struct{}, worker)
 	var wg sync.WaitGroup
 
@@ -146,13 +168,7 @@ func (r *ConnRabbitMQ) processMessages(ctx context.Context, worker int, msgs <-c
 					wg.Done()
 				}()
 
-				if err := f(msg); err != nil {
-					log.Printf("[RabbitMQ] Erro no handler: %v", err)
-					return
-				}
-				if err := msg.Ack(false); err != nil {
-					log.Printf("[RabbitMQ] Erro ao fazer ACK: %v", err)
-				}
+				handle(msg)
 			}(d)
 		}
 	}
@@ -0,0 +1,201 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type HandlesBatchRabbitMQ func(deliveries []amqp.Delivery) error
+
+// BatchError lets a batch handler report individual failures. Deliveries at
+// the failed indexes are nacked and the rest of the batch is acked.
+type BatchError struct {
+	Failed map[int]error
+}
+
+func NewBatchError() *BatchError {
+	return &BatchError{Failed: make(map[int]error)}
+}
+
+func (e *BatchError) Add(index int, err error) {
+	e.Failed[index] = err
+}
+
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Failed))
+	for i := range e.Failed {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	parts := make([]string, len(indexes))
+	for n, i := range indexes {
+		parts[n] = fmt.Sprintf("[%d] %v", i, e.Failed[i])
+	}
+	return fmt.Sprintf("%d deliveries failed: %s", len(e.Failed), strings.Join(parts, "; "))
+}
+
+type BatchOptions struct {
+	// Size is the maximum number of deliveries per batch.
+	Size int
+	// Window is how long to wait for a batch to fill after its first delivery.
+	Window time.Duration
+	// Prefetch is the channel QoS; it is raised to Size when smaller.
+	Prefetch int
+	// DeadLetter nacks failed deliveries without requeue, routing them to the
+	// queue's dead-letter exchange. By default they are requeued, since on a
+	// queue without a dead-letter exchange DeadLetter discards them.
+	DeadLetter bool
+}
+
+// BatchConsumer delivers messages to f in batches of up to opts.Size, or
+// whatever arrived within opts.Window. A successful batch is acked at once
+// with multiple=true and a failed one nacked the same way, unless f returns a
+// *BatchError to settle deliveries individually. It uses its own channel so
+// multiple acks never touch deliveries of other consumers.
+func (r *ConnRabbitMQ) BatchConsumer(ctx context.Context, opts BatchOptions, queue, nameConsumer string, f HandlesBatchRabbitMQ) error {
+	if opts.Size <= 0 {
+		return fmt.Errorf("batch size must be greater than zero")
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Second
+	}
+	if opts.Prefetch < opts.Size {
+		opts.Prefetch = opts.Size
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		if err := r.consumeBatches(ctx, opts, queue, nameConsumer, f); err != nil {
+			log.Printf("[RabbitMQ] Batch consumer retornou erro: %v - reconectando...", err)
+			r.Metrics.reconnect(queue)
+			time.Sleep(3 * time.Second)
+		}
+	}
+}
+
+func (r *ConnRabbitMQ) consumeBatches(ctx context.Context, opts BatchOptions, queue, nameConsumer string, f HandlesBatchRabbitMQ) error {
+	if r.Connection == nil || r.Connection.IsClosed() {
+		return fmt.Errorf("connection is not open")
+	}
+	ch, err := r.Connection.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if err := ch.Qos(opts.Prefetch, 0, false); err != nil {
+		return err
+	}
+	msgs, err := ch.ConsumeWithContext(ctx, queue, nameConsumer, false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	log.Printf("[RabbitMQ] Batch consumer registrado com sucesso na fila %s", queue)
+
+	batch := make([]amqp.Delivery, 0, opts.Size)
+	dones := make([]func(error), 0, opts.Size)
+	timer := time.NewTimer(opts.Window)
+	timer.Stop()
+	defer timer.Stop()
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() {
+			batch = batch[:0]
+			dones = dones[:0]
+		}()
+		return r.settleBatch(ch, opts, queue, batch, dones, f(batch))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		case d, ok := <-msgs:
+			if !ok {
+				return fmt.Errorf("canal de mensagens fechado")
+			}
+			if len(batch) == 0 {
+				timer.Reset(opts.Window)
+			}
+			batch = append(batch, d)
+			dones = append(dones, r.Metrics.start(queue))
+			if len(batch) >= opts.Size {
+				timer.Stop()
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// acknowledger is the part of *amqp.Channel used to settle a batch.
+type acknowledger interface {
+	Ack(tag uint64, multiple bool) error
+	Nack(tag uint64, multiple, requeue bool) error
+}
+
+func (r *ConnRabbitMQ) settleBatch(ch acknowledger, opts BatchOptions, queue string, batch []amqp.Delivery, dones []func(error), handlerErr error) error {
+	last := batch[len(batch)-1].DeliveryTag
+
+	var batchErr *BatchError
+	partial := errors.As(handlerErr, &batchErr)
+	if partial && (batchErr == nil || len(batchErr.Failed) == 0) {
+		// A nil or empty BatchError means every delivery succeeded.
+		partial, handlerErr = false, nil
+	}
+	if !partial {
+		for _, done := range dones {
+			done(handlerErr)
+		}
+		if handlerErr != nil {
+			log.Printf("[RabbitMQ] Erro no handler do lote: %v", handlerErr)
+			for range batch {
+				r.Metrics.nack(queue)
+			}
+			return ch.Nack(last, true, !opts.DeadLetter)
+		}
+		err := ch.Ack(last, true)
+		for range batch {
+			r.Metrics.ack(queue, err)
+		}
+		return err
+	}
+
+	log.Printf("[RabbitMQ] Falhas parciais no lote: %v", batchErr)
+	for i, d := range batch {
+		if err, failed := batchErr.Failed[i]; failed {
+			dones[i](err)
+			r.Metrics.nack(queue)
+			if err := ch.Nack(d.DeliveryTag, false, !opts.DeadLetter); err != nil {
+				return err
+			}
+			continue
+		}
+		dones[i](nil)
+		err := ch.Ack(d.DeliveryTag, false)
+		r.Metrics.ack(queue, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
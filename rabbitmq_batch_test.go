@@ -0,0 +1,71 @@
+package gorote
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type fakeAcknowledger struct {
+	acked, nacked []uint64
+	requeued      []bool
+}
+
+func (f *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	f.acked = append(f.acked, tag)
+	return nil
+}
+
+func (f *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	f.nacked = append(f.nacked, tag)
+	f.requeued = append(f.requeued, requeue)
+	return nil
+}
+
+func (f *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return f.Nack(tag, false, requeue)
+}
+
+func TestSettleBatch(t *testing.T) {
+	r := &ConnRabbitMQ{}
+	batch := []amqp.Delivery{{DeliveryTag: 1}, {DeliveryTag: 2}, {DeliveryTag: 3}}
+	dones := []func(error){func(error) {}, func(error) {}, func(error) {}}
+
+	t.Run("BatchError encapsulado", func(t *testing.T) {
+		batchErr := NewBatchError()
+		batchErr.Add(1, errors.New("inválida"))
+		ch := &fakeAcknowledger{}
+		if err := r.settleBatch(ch, BatchOptions{}, "q", batch, dones, fmt.Errorf("lote: %w", batchErr)); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(ch.acked, ch.nacked) != "[1 3] [2]" {
+			t.Errorf("esperava ack de 1 e 3 e nack de 2, recebeu %v %v", ch.acked, ch.nacked)
+		}
+	})
+
+	t.Run("BatchError nil ou vazio é sucesso", func(t *testing.T) {
+		for _, err := range []error{(*BatchError)(nil), NewBatchError()} {
+			ch := &fakeAcknowledger{}
+			if err := r.settleBatch(ch, BatchOptions{}, "q", batch, dones, err); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(ch.acked, ch.nacked) != "[3] []" {
+				t.Errorf("esperava ack múltiplo até 3, recebeu %v %v", ch.acked, ch.nacked)
+			}
+		}
+	})
+
+	t.Run("falha volta para a fila por padrão", func(t *testing.T) {
+		for _, opts := range []BatchOptions{{}, {DeadLetter: true}} {
+			ch := &fakeAcknowledger{}
+			if err := r.settleBatch(ch, opts, "q", batch, dones, errors.New("falhou")); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(ch.nacked, ch.requeued) != fmt.Sprintf("[3] [%v]", !opts.DeadLetter) {
+				t.Errorf("DeadLetter=%v: nack inesperado %v %v", opts.DeadLetter, ch.nacked, ch.requeued)
+			}
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// delayQueueName returns the holding queue for messages delayed by delay
+// before reaching queueName. One queue per delay avoids messages with a short
+// TTL getting stuck behind longer ones, since RabbitMQ only expires the head;
+// delay must already be rounded by delayBucket to bound the number of queues.
+func delayQueueName(queueName string, delay time.Duration) string {
+	return fmt.Sprintf("%s.delay.%d", queueName, delay.Milliseconds())
+}
+
+// delayBucket rounds delay up to two significant digits, with a minimum step
+// of 100ms, so there are at most 90 holding queues per order of magnitude and
+// messages are never delivered early, nor more than about 10% late.
+func delayBucket(delay time.Duration) time.Duration {
+	step := 100 * time.Millisecond
+	for delay > 100*step {
+		step *= 10
+	}
+	return (delay + step - 1) / step * step
+}
+
+// PublishDelayed publishes data so it is delivered to queueName after delay.
+// The message waits in a holding queue with a TTL and is dead-lettered to
+// queueName once it expires. delay is rounded up as described in delayBucket,
+// and unused holding queues are deleted by the broker.
+func (r *ConnRabbitMQ) PublishDelayed(ctx context.Context, queueName string, data any, delay time.Duration) error {
+	if delay <= 0 {
+		return r.Publish(ctx, queueName, data)
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize struct: %w", err)
+	}
+
+	delay = delayBucket(delay)
+	ttl := delay.Milliseconds()
+	holding := delayQueueName(queueName, delay)
+	_, err = r.Channel.QueueDeclare(holding, true, false, false, false, amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": queueName,
+		"x-message-ttl":             ttl,
+		"x-expires":                 ttl*2 + int64(time.Minute/time.Millisecond),
+	})
+	if err != nil {
+		return fmt.Errorf("falha ao declarar fila de atraso: %w", err)
+	}
+
+	err = r.Channel.PublishWithContext(ctx,
+		"",
+		holding,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Expiration:   strconv.FormatInt(ttl, 10),
+			Body:         body,
+			Timestamp:    time.Now(),
+		})
+	if err != nil {
+		return fmt.Errorf("falha ao publicar na fila: %w", err)
+	}
+
+	log.Printf("[RabbitMQ] Mensagem agendada para a fila %s em %s", queueName, delay)
+	return nil
+}
+
+// PublishAt publishes data so it is delivered to queueName at the given time.
+func (r *ConnRabbitMQ) PublishAt(ctx context.Context, queueName string, data any, at time.Time) error {
+	return r.PublishDelayed(ctx, queueName, data, time.Until(at))
+}
@@ -0,0 +1,50 @@
+package gorote
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayBucket(t *testing.T) {
+	cases := map[time.Duration]time.Duration{
+		50 * time.Millisecond:                      100 * time.Millisecond,
+		1234 * time.Millisecond:                    1300 * time.Millisecond,
+		97*time.Second + 400*time.Millisecond:      98 * time.Second,
+		10*time.Minute + 1*time.Second:             610 * time.Second,
+		3*time.Hour + 25*time.Minute + time.Second: 13000 * time.Second,
+	}
+	for delay, want := range cases {
+		if got := delayBucket(delay); got != want {
+			t.Errorf("delayBucket(%s) = %s, esperava %s", delay, got, want)
+		}
+	}
+
+	queues := map[string]bool{}
+	for ms := 1; ms <= int(time.Hour/time.Millisecond); ms += 997 {
+		queues[delayQueueName("pedidos", delayBucket(time.Duration(ms)*time.Millisecond))] = true
+	}
+	if len(queues) > 300 {
+		t.Errorf("delays de até 1h não deveriam criar %d filas", len(queues))
+	}
+}
+
+func TestPublishDelayedRabbitMQ(t *testing.T) {
+	r := newTestRabbitMQ(t)
+	queue := testQueue(t, r)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := r.PublishAt(ctx, queue, i, time.Now().Add(200*time.Millisecond+time.Duration(i)*time.Millisecond)); err != nil {
+			t.Fatalf("erro ao agendar: %v", err)
+		}
+	}
+	if _, err := r.Channel.QueueDeclarePassive(queue+".delay.300", true, false, false, false, nil); err != nil {
+		t.Fatalf("delays próximos deveriam compartilhar a fila de espera: %v", err)
+	}
+	time.Sleep(time.Second)
+	info, err := r.Channel.QueueDeclarePassive(queue, false, true, true, false, nil)
+	if err != nil || info.Messages != 3 {
+		t.Errorf("esperava 3 mensagens entregues, recebeu %+v %v", info, err)
+	}
+}
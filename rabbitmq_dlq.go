@@ -0,0 +1,192 @@
+package gorote
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DLQRabbitMQ inspects and replays a RabbitMQ dead-letter queue. Messages are
+// read with basic.get on a dedicated channel and the ones left untouched are
+// requeued when it closes, so a scan may change their order in the queue.
+type DLQRabbitMQ struct {
+	Conn  *ConnRabbitMQ
+	Queue string
+}
+
+func (r *ConnRabbitMQ) DeadLetterQueue(queue string) *DLQRabbitMQ {
+	return &DLQRabbitMQ{Conn: r, Queue: queue}
+}
+
+func (q *DLQRabbitMQ) Count(ctx context.Context) (int, error) {
+	ch, err := q.Conn.Connection.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("falha ao abrir canal: %w", err)
+	}
+	defer ch.Close()
+	info, err := ch.QueueDeclarePassive(q.Queue, true, false, false, false, nil)
+	if err != nil {
+		return 0, fmt.Errorf("falha ao inspecionar fila %s: %w", q.Queue, err)
+	}
+	return info.Messages, nil
+}
+
+func (q *DLQRabbitMQ) Peek(ctx context.Context, limit int, filter DeadLetterFilter) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := q.scan(ctx, false, func(_ *confirmedChannel, d amqp.Delivery, letter DeadLetter) (bool, error) {
+		if filter.match(letter) {
+			letters = append(letters, letter)
+		}
+		return limit > 0 && len(letters) >= limit, nil
+	})
+	return letters, err
+}
+
+func (q *DLQRabbitMQ) Redrive(ctx context.Context, opts RedriveOptions) (*RedriveResult, error) {
+	result := &RedriveResult{}
+	wait := throttle(opts.Rate)
+	err := q.scan(ctx, true, func(ch *confirmedChannel, d amqp.Delivery, letter DeadLetter) (bool, error) {
+		if !opts.Filter.match(letter) {
+			result.Skipped++
+			return false, nil
+		}
+		target := opts.Target
+		if target == "" {
+			target = letter.Source
+		}
+		if target == "" {
+			log.Printf("[RabbitMQ] Mensagem %s sem fila de origem, ignorada", letter.ID)
+			result.Skipped++
+			return false, nil
+		}
+		if err := wait(ctx); err != nil {
+			return true, err
+		}
+
+		// A target that does not exist returns the message, which must then
+		// stay in the dead-letter queue.
+		if err := ch.publish(ctx, target, redrivePublishing(d)); err != nil {
+			d.Nack(false, true)
+			return true, fmt.Errorf("falha ao republicar mensagem %s em %s: %w", letter.ID, target, err)
+		}
+		if err := d.Ack(false); err != nil {
+			return true, fmt.Errorf("falha ao confirmar mensagem %s: %w", letter.ID, err)
+		}
+		result.Moved++
+		return opts.Limit > 0 && result.Moved >= opts.Limit, nil
+	})
+	return result, err
+}
+
+// scan calls visit for every message currently in the queue until it returns
+// true. Messages visit does not ack are requeued once the scan ends.
+func (q *DLQRabbitMQ) scan(ctx context.Context, confirm bool, visit func(*confirmedChannel, amqp.Delivery, DeadLetter) (bool, error)) error {
+	var ch *confirmedChannel
+	var err error
+	if confirm {
+		ch, err = q.Conn.confirmChannel()
+	} else {
+		var plain *amqp.Channel
+		if plain, err = q.Conn.Connection.Channel(); err != nil {
+			err = fmt.Errorf("falha ao abrir canal: %w", err)
+		}
+		ch = &confirmedChannel{Channel: plain}
+	}
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	info, err := ch.QueueDeclarePassive(q.Queue, true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("falha ao inspecionar fila %s: %w", q.Queue, err)
+	}
+
+	// Unacked messages stay with this channel, so reading at most the
+	// initial depth never sees the same message twice.
+	for i := 0; i < info.Messages; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d, ok, err := ch.Get(q.Queue, false)
+		if err != nil {
+			return fmt.Errorf("falha ao ler fila %s: %w", q.Queue, err)
+		}
+		if !ok {
+			return nil
+		}
+		done, err := visit(ch, d, deadLetterRabbitMQ(d))
+		if err != nil || done {
+			return err
+		}
+	}
+	return nil
+}
+
+func deadLetterRabbitMQ(d amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		ID:        d.MessageId,
+		Body:      string(d.Body),
+		Timestamp: d.Timestamp,
+		Headers:   make(map[string]string, len(d.Headers)),
+	}
+	if letter.ID == "" {
+		letter.ID = MessageIDRabbitMQ(d)
+	}
+	for k, v := range d.Headers {
+		if k == "x-death" {
+			continue
+		}
+		letter.Headers[k] = fmt.Sprint(v)
+	}
+	if d.ContentType != "" {
+		letter.Headers["content-type"] = d.ContentType
+	}
+
+	deaths, _ := d.Headers["x-death"].([]any)
+	for _, death := range deaths {
+		table, ok := death.(amqp.Table)
+		if !ok {
+			continue
+		}
+		if count, ok := table["count"].(int64); ok {
+			letter.Attempts += int(count)
+		}
+	}
+	if source, ok := d.Headers["x-first-death-queue"].(string); ok {
+		letter.Source = source
+	} else if len(deaths) > 0 {
+		if table, ok := deaths[0].(amqp.Table); ok {
+			letter.Source, _ = table["queue"].(string)
+		}
+	}
+	return letter
+}
+
+// redrivePublishing copies d without the headers RabbitMQ adds when
+// dead-lettering, so a replayed message starts over.
+func redrivePublishing(d amqp.Delivery) amqp.Publishing {
+	headers := make(amqp.Table, len(d.Headers))
+	for k, v := range d.Headers {
+		if k == "x-death" || strings.HasPrefix(k, "x-first-death-") || strings.HasPrefix(k, "x-last-death-") {
+			continue
+		}
+		headers[k] = v
+	}
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
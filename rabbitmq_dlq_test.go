@@ -0,0 +1,54 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestCheckReturn(t *testing.T) {
+	returns := make(chan amqp.Return, 1)
+	if err := checkReturn(returns, "1"); err != nil {
+		t.Errorf("sem devolução não deveria falhar: %v", err)
+	}
+	returns <- amqp.Return{RoutingKey: "pedidoz", ReplyText: "NO_ROUTE"}
+	if err := checkReturn(returns, "1"); !errors.Is(err, ErrUnroutable) {
+		t.Errorf("esperava ErrUnroutable, recebeu %v", err)
+	}
+}
+
+func TestRedriveRabbitMQ(t *testing.T) {
+	r := newTestRabbitMQ(t)
+	dlq := testQueue(t, r)
+	target := testQueue(t, r)
+	ctx := context.Background()
+	for _, id := range []string{"m1", "m2"} {
+		err := r.Channel.PublishWithContext(ctx, "", dlq, false, false, amqp.Publishing{MessageId: id, Body: []byte(`{}`)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	q := r.DeadLetterQueue(dlq)
+
+	t.Run("fila de destino inexistente mantém a mensagem", func(t *testing.T) {
+		result, err := q.Redrive(ctx, RedriveOptions{Target: target + "-inexistente"})
+		if !errors.Is(err, ErrUnroutable) || result.Moved != 0 {
+			t.Fatalf("esperava ErrUnroutable sem mover nada, recebeu %+v %v", result, err)
+		}
+		if n, _ := q.Count(ctx); n != 2 {
+			t.Errorf("mensagens deveriam continuar na DLQ, restam %d", n)
+		}
+	})
+
+	t.Run("move para a fila de destino", func(t *testing.T) {
+		result, err := q.Redrive(ctx, RedriveOptions{Target: target})
+		if err != nil || result.Moved != 2 {
+			t.Fatalf("esperava 2 mensagens movidas, recebeu %+v %v", result, err)
+		}
+		if n, _ := q.Count(ctx); n != 0 {
+			t.Errorf("DLQ deveria estar vazia, restam %d", n)
+		}
+	})
+}
@@ -0,0 +1,227 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	directReplyTo  = "amq.rabbitmq.reply-to"
+	headerRPCError = "x-rpc-error"
+)
+
+var (
+	ErrRPCTimeout = errors.New("rpc: timeout waiting for reply")
+	// ErrRPCClosed is returned to calls pending when the reply channel closes,
+	// since direct replies only arrive on the channel the request used.
+	ErrRPCClosed = errors.New("rpc: reply channel closed")
+)
+
+// HandlerRPC processes a request delivery and returns the value sent back to
+// the caller. A non-nil error is propagated to the caller as a remote error.
+type HandlerRPC func(ctx context.Context, delivery amqp.Delivery) (any, error)
+
+// RPCRabbitMQ sends requests over RabbitMQ and waits for replies using the
+// direct reply-to pseudo queue, matching them by correlation ID.
+type RPCRabbitMQ struct {
+	Timeout time.Duration
+
+	conn    *ConnRabbitMQ
+	mu      sync.Mutex
+	channel *amqp.Channel
+	// generation counts the reply channels opened, so closing one only fails
+	// the calls published on it.
+	generation uint64
+	pending    map[string]pendingRPC
+}
+
+type pendingRPC struct {
+	reply      chan amqp.Delivery
+	generation uint64
+}
+
+func (r *ConnRabbitMQ) NewRPCClient(timeout time.Duration) *RPCRabbitMQ {
+	return &RPCRabbitMQ{
+		Timeout: timeout,
+		conn:    r,
+		pending: make(map[string]pendingRPC),
+	}
+}
+
+// Call publishes request to queue and decodes the reply into response. The
+// call is bounded by the context deadline or, if none is set, by Timeout.
+func (c *RPCRabbitMQ) Call(ctx context.Context, queue string, request, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to serialize request: %w", err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	correlationID := uuid.NewString()
+	reply := make(chan amqp.Delivery, 1)
+
+	c.mu.Lock()
+	ch, err := c.replyChannel()
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.pending[correlationID] = pendingRPC{reply: reply, generation: c.generation}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, correlationID)
+		c.mu.Unlock()
+	}()
+
+	err = ch.PublishWithContext(ctx, "", queue, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: correlationID,
+		ReplyTo:       directReplyTo,
+		Body:          body,
+		Timestamp:     time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("falha ao publicar requisição RPC: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ErrRPCTimeout
+		}
+		return ctx.Err()
+	case d, ok := <-reply:
+		if !ok {
+			return ErrRPCClosed
+		}
+		if msg, ok := d.Headers[headerRPCError]; ok {
+			return fmt.Errorf("rpc: remote error: %v", msg)
+		}
+		if response == nil || len(d.Body) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(d.Body, response); err != nil {
+			return fmt.Errorf("failed to deserialize reply: %w", err)
+		}
+		return nil
+	}
+}
+
+// replyChannel returns the channel consuming direct replies, opening a new one
+// when the previous was closed (e.g. after a reconnect). Must hold c.mu.
+func (c *RPCRabbitMQ) replyChannel() (*amqp.Channel, error) {
+	if c.channel != nil && !c.channel.IsClosed() {
+		return c.channel, nil
+	}
+	if c.conn.Connection == nil || c.conn.Connection.IsClosed() {
+		return nil, fmt.Errorf("rpc: connection is not open")
+	}
+
+	ch, err := c.conn.Connection.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("rpc: failed to open channel: %w", err)
+	}
+	replies, err := ch.Consume(directReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("rpc: failed to consume replies: %w", err)
+	}
+
+	c.channel = ch
+	c.generation++
+	go c.dispatch(replies, c.generation)
+	return ch, nil
+}
+
+// dispatch routes replies to the pending calls until the channel or its
+// connection closes, then fails the calls still waiting on it.
+func (c *RPCRabbitMQ) dispatch(replies <-chan amqp.Delivery, generation uint64) {
+	for d := range replies {
+		c.mu.Lock()
+		call, ok := c.pending[d.CorrelationId]
+		c.mu.Unlock()
+		if !ok {
+			log.Printf("[RabbitMQ] Resposta RPC sem requisição pendente: %s", d.CorrelationId)
+			continue
+		}
+		select {
+		case call.reply <- d:
+		default:
+			log.Printf("[RabbitMQ] Resposta RPC duplicada descartada: %s", d.CorrelationId)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, call := range c.pending {
+		if call.generation == generation {
+			close(call.reply)
+			delete(c.pending, id)
+		}
+	}
+}
+
+// CallRabbitMQ is the typed form of RPCRabbitMQ.Call.
+func CallRabbitMQ[T any](ctx context.Context, c *RPCRabbitMQ, queue string, request any) (T, error) {
+	var response T
+	err := c.Call(ctx, queue, request, &response)
+	return response, err
+}
+
+// ServeRPC consumes requests from queue and publishes the handler result to
+// the ReplyTo address of each request.
+func (r *ConnRabbitMQ) ServeRPC(ctx context.Context, worker int, queue, nameConsumer string, handler HandlerRPC) error {
+	return r.Consumer(ctx, worker, queue, nameConsumer, func(d amqp.Delivery) error {
+		result, err := handler(ctx, d)
+		if d.ReplyTo == "" {
+			return err
+		}
+
+		reply := amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: d.CorrelationId,
+			Timestamp:     time.Now(),
+		}
+		if err != nil {
+			reply.Headers = amqp.Table{headerRPCError: err.Error()}
+		} else if result != nil {
+			body, err := json.Marshal(result)
+			if err != nil {
+				return fmt.Errorf("failed to serialize reply: %w", err)
+			}
+			reply.Body = body
+		}
+
+		if err := r.Channel.PublishWithContext(ctx, "", d.ReplyTo, false, false, reply); err != nil {
+			return fmt.Errorf("falha ao publicar resposta RPC: %w", err)
+		}
+		return nil
+	})
+}
+
+// HandleRPC adapts a typed function into a HandlerRPC, decoding the request
+// body as JSON.
+func HandleRPC[Req, Resp any](fn func(context.Context, Req) (Resp, error)) HandlerRPC {
+	return func(ctx context.Context, d amqp.Delivery) (any, error) {
+		var req Req
+		if err := json.Unmarshal(d.Body, &req); err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+		return fn(ctx, req)
+	}
+}
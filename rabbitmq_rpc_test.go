@@ -0,0 +1,114 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRPCDispatch(t *testing.T) {
+	c := &RPCRabbitMQ{pending: make(map[string]pendingRPC)}
+	register := func(id string, generation uint64) chan amqp.Delivery {
+		reply := make(chan amqp.Delivery, 1)
+		c.pending[id] = pendingRPC{reply: reply, generation: generation}
+		return reply
+	}
+	first := register("a", 1)
+	second := register("b", 1)
+	other := register("c", 2)
+
+	replies := make(chan amqp.Delivery, 3)
+	replies <- amqp.Delivery{CorrelationId: "b", Body: []byte(`"resposta b"`)}
+	replies <- amqp.Delivery{CorrelationId: "desconhecida"}
+	replies <- amqp.Delivery{CorrelationId: "b", Body: []byte(`"duplicada"`)}
+	close(replies)
+	c.dispatch(replies, 1)
+
+	t.Run("resposta vai para a chamada certa", func(t *testing.T) {
+		if d, ok := <-second; !ok || string(d.Body) != `"resposta b"` {
+			t.Errorf("esperava a resposta de b, recebeu %q %v", d.Body, ok)
+		}
+	})
+
+	t.Run("fechar o canal falha as chamadas pendentes", func(t *testing.T) {
+		if _, ok := <-first; ok {
+			t.Error("chamada a deveria ter o canal de resposta fechado")
+		}
+		if _, ok := c.pending["a"]; ok {
+			t.Error("chamada a deveria ter saído das pendentes")
+		}
+	})
+
+	t.Run("chamadas de outro canal não são afetadas", func(t *testing.T) {
+		select {
+		case <-other:
+			t.Error("chamada c não deveria receber nada")
+		default:
+		}
+		if _, ok := c.pending["c"]; !ok {
+			t.Error("chamada c deveria continuar pendente")
+		}
+	})
+}
+
+func TestRPCRabbitMQ(t *testing.T) {
+	r := newTestRabbitMQ(t)
+	queue := testQueue(t, r)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.ServeRPC(ctx, 4, queue, "rpc-test", HandleRPC(func(ctx context.Context, n int) (string, error) {
+		if n < 0 {
+			return "", errors.New("negativo")
+		}
+		time.Sleep(time.Duration(10-n) * time.Millisecond)
+		return fmt.Sprintf("n=%d", n), nil
+	}))
+	client := r.NewRPCClient(5 * time.Second)
+
+	t.Run("respostas correspondem às chamadas", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := CallRabbitMQ[string](ctx, client, queue, i)
+				if err != nil || resp != fmt.Sprintf("n=%d", i) {
+					t.Errorf("chamada %d recebeu %q %v", i, resp, err)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("erro remoto", func(t *testing.T) {
+		if _, err := CallRabbitMQ[string](ctx, client, queue, -1); err == nil {
+			t.Error("esperava erro remoto")
+		}
+	})
+
+	t.Run("timeout sem servidor", func(t *testing.T) {
+		idle := testQueue(t, r)
+		short := r.NewRPCClient(50 * time.Millisecond)
+		if err := short.Call(ctx, idle, 1, nil); !errors.Is(err, ErrRPCTimeout) {
+			t.Errorf("esperava ErrRPCTimeout, recebeu %v", err)
+		}
+	})
+
+	t.Run("canal fechado falha a chamada", func(t *testing.T) {
+		idle := testQueue(t, r)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			client.mu.Lock()
+			client.channel.Close()
+			client.mu.Unlock()
+		}()
+		if err := client.Call(ctx, idle, 1, nil); !errors.Is(err, ErrRPCClosed) {
+			t.Errorf("esperava ErrRPCClosed, recebeu %v", err)
+		}
+	})
+}
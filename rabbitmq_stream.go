@@ -0,0 +1,420 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StreamOffset is the x-stream-offset a stream consumer starts from when no
+// offset was stored for it yet.
+type StreamOffset struct {
+	value any
+}
+
+func StreamOffsetFirst() StreamOffset { return StreamOffset{"first"} }
+
+func StreamOffsetLast() StreamOffset { return StreamOffset{"last"} }
+
+func StreamOffsetNext() StreamOffset { return StreamOffset{"next"} }
+
+func StreamOffsetAt(t time.Time) StreamOffset { return StreamOffset{t} }
+
+func StreamOffsetValue(offset int64) StreamOffset { return StreamOffset{offset} }
+
+// OffsetStore persists the last offset processed by a stream consumer so a
+// restarted consumer resumes right after it.
+type OffsetStore interface {
+	LoadOffset(ctx context.Context, stream, consumer string) (offset int64, ok bool, err error)
+	SaveOffset(ctx context.Context, stream, consumer string, offset int64) error
+}
+
+type RedisOffsetStore struct {
+	Redis  *redis.Client
+	Prefix string
+}
+
+func NewRedisOffsetStore(client *redis.Client) *RedisOffsetStore {
+	return &RedisOffsetStore{Redis: client, Prefix: "gorote:stream:offset:"}
+}
+
+func (s *RedisOffsetStore) key(stream, consumer string) string {
+	return s.Prefix + stream + ":" + consumer
+}
+
+func (s *RedisOffsetStore) LoadOffset(ctx context.Context, stream, consumer string) (int64, bool, error) {
+	offset, err := s.Redis.Get(ctx, s.key(stream, consumer)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return offset, true, nil
+}
+
+func (s *RedisOffsetStore) SaveOffset(ctx context.Context, stream, consumer string, offset int64) error {
+	return s.Redis.Set(ctx, s.key(stream, consumer), offset, 0).Err()
+}
+
+type StreamOffsetRecord struct {
+	Stream    string `gorm:"primaryKey;size:255"`
+	Consumer  string `gorm:"primaryKey;size:255"`
+	Offset    int64  `gorm:"not null"`
+	UpdatedAt time.Time
+}
+
+func (StreamOffsetRecord) TableName() string {
+	return "stream_offsets"
+}
+
+// GormOffsetStore keeps offsets in the stream_offsets table; migrate it with
+// db.AutoMigrate(&StreamOffsetRecord{}).
+type GormOffsetStore struct {
+	DB *gorm.DB
+}
+
+func (s *GormOffsetStore) LoadOffset(ctx context.Context, stream, consumer string) (int64, bool, error) {
+	var record StreamOffsetRecord
+	err := s.DB.WithContext(ctx).Where("stream = ? AND consumer = ?", stream, consumer).Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return record.Offset, true, nil
+}
+
+func (s *GormOffsetStore) SaveOffset(ctx context.Context, stream, consumer string, offset int64) error {
+	record := StreamOffsetRecord{Stream: stream, Consumer: consumer, Offset: offset, UpdatedAt: time.Now()}
+	return s.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "stream"}, {Name: "consumer"}},
+		DoUpdates: clause.AssignmentColumns([]string{"offset", "updated_at"}),
+	}).Create(&record).Error
+}
+
+// memoryOffsetStore keeps offsets for the lifetime of a single ConsumeStream
+// call, so restarts resume where the consumer stopped.
+type memoryOffsetStore struct {
+	mu      sync.Mutex
+	offsets map[string]int64
+}
+
+func (s *memoryOffsetStore) LoadOffset(_ context.Context, stream, consumer string) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offset, ok := s.offsets[stream+":"+consumer]
+	return offset, ok, nil
+}
+
+func (s *memoryOffsetStore) SaveOffset(_ context.Context, stream, consumer string, offset int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.offsets == nil {
+		s.offsets = make(map[string]int64)
+	}
+	s.offsets[stream+":"+consumer] = offset
+	return nil
+}
+
+// StreamConsumer configures ConsumeStream.
+type StreamConsumer struct {
+	Stream string
+	Name   string
+	// Start is used when Store has no offset for Name. Defaults to next.
+	Start StreamOffset
+	// Store tracks processed offsets. Without it offsets are kept in memory:
+	// restarts resume after the last processed message, but a new process
+	// begins at Start.
+	Store    OffsetStore
+	Prefetch int
+	// CommitEvery saves the offset after this many messages. Defaults to 1.
+	CommitEvery int
+	// RestartDelay is the wait before restarting after an error. Defaults
+	// to 3s.
+	RestartDelay time.Duration
+	// MaxFailures is how many times in a row the handler may fail without
+	// any message being processed before ConsumeStream gives up and returns
+	// the error. Defaults to 5.
+	MaxFailures int
+}
+
+func (r *ConnRabbitMQ) DeclareStream(name string, maxAge time.Duration, maxBytes int64) error {
+	_, err := r.Channel.QueueDeclare(name, true, false, false, false, streamArgs(maxAge, maxBytes))
+	if err != nil {
+		return fmt.Errorf("falha ao declarar stream %s: %w", name, err)
+	}
+	return nil
+}
+
+func streamArgs(maxAge time.Duration, maxBytes int64) amqp.Table {
+	args := amqp.Table{"x-queue-type": "stream"}
+	if maxAge > 0 {
+		args["x-max-age"] = fmt.Sprintf("%ds", int64(maxAge/time.Second))
+	}
+	if maxBytes > 0 {
+		args["x-max-length-bytes"] = maxBytes
+	}
+	return args
+}
+
+var errStreamHandler = errors.New("stream handler failed")
+
+// ConsumeStream reads a stream queue in order, one message at a time. Each
+// message is acked after f succeeds and its offset saved to sc.Store. When f
+// fails the consumer is restarted from the last stored offset, and after
+// sc.MaxFailures failures in a row the handler error is returned.
+func (r *ConnRabbitMQ) ConsumeStream(ctx context.Context, sc StreamConsumer, f HandlesRabbitMQ) error {
+	if sc.Prefetch <= 0 {
+		sc.Prefetch = 100
+	}
+	if sc.CommitEvery <= 0 {
+		sc.CommitEvery = 1
+	}
+	if sc.Start.value == nil {
+		sc.Start = StreamOffsetNext()
+	}
+	if sc.Store == nil {
+		sc.Store = &memoryOffsetStore{}
+	}
+	if sc.RestartDelay <= 0 {
+		sc.RestartDelay = 3 * time.Second
+	}
+	if sc.MaxFailures <= 0 {
+		sc.MaxFailures = 5
+	}
+	return r.restartStream(ctx, sc, func() (bool, error) {
+		return r.consumeStreamOnce(ctx, sc, f)
+	})
+}
+
+// restartStream runs once until ctx is done, waiting sc.RestartDelay after
+// every error. once reports whether it processed any message, which resets
+// the count of handler failures.
+func (r *ConnRabbitMQ) restartStream(ctx context.Context, sc StreamConsumer, once func() (bool, error)) error {
+	failures := 0
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		processed, err := once()
+		if err == nil {
+			continue
+		}
+		if processed {
+			failures = 0
+		}
+		if errors.Is(err, errStreamHandler) {
+			if failures++; failures >= sc.MaxFailures {
+				return fmt.Errorf("stream %s: %d failures in a row: %w", sc.Stream, failures, err)
+			}
+		}
+		log.Printf("[RabbitMQ] Stream %s interrompido: %v - reiniciando...", sc.Stream, err)
+		r.Metrics.reconnect(sc.Stream)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(sc.RestartDelay):
+		}
+	}
+}
+
+// consumeStreamOnce consumes from the offset after the last stored one until
+// ctx is done or an error occurs. processed reports whether any message was
+// handled successfully.
+func (r *ConnRabbitMQ) consumeStreamOnce(ctx context.Context, sc StreamConsumer, f HandlesRabbitMQ) (processed bool, err error) {
+	start := sc.Start.value
+	offset, ok, err := sc.Store.LoadOffset(ctx, sc.Stream, sc.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to load offset: %w", err)
+	}
+	if ok {
+		start = offset + 1
+	}
+
+	if r.Connection == nil || r.Connection.IsClosed() {
+		return false, fmt.Errorf("connection is not open")
+	}
+	ch, err := r.Connection.Channel()
+	if err != nil {
+		return false, err
+	}
+	defer ch.Close()
+
+	if err := ch.Qos(sc.Prefetch, 0, false); err != nil {
+		return false, err
+	}
+	msgs, err := ch.ConsumeWithContext(ctx, sc.Stream, sc.Name, false, false, false, false, amqp.Table{
+		"x-stream-offset": start,
+	})
+	if err != nil {
+		return false, err
+	}
+	log.Printf("[RabbitMQ] Consumer registrado com sucesso no stream %s a partir de %v", sc.Stream, start)
+
+	var pending int
+	var last int64 = -1
+	commit := func() error {
+		if last < 0 || pending == 0 {
+			return nil
+		}
+		pending = 0
+		return sc.Store.SaveOffset(context.WithoutCancel(ctx), sc.Stream, sc.Name, last)
+	}
+	defer commit()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return processed, nil
+		case d, ok := <-msgs:
+			if !ok {
+				return processed, fmt.Errorf("canal de mensagens fechado")
+			}
+			done := r.Metrics.start(sc.Stream)
+			err := f(d)
+			done(err)
+			if err != nil {
+				return processed, fmt.Errorf("%w: %w", errStreamHandler, err)
+			}
+			processed = true
+			err = d.Ack(false)
+			r.Metrics.ack(sc.Stream, err)
+			if err != nil {
+				return processed, err
+			}
+			if offset, ok := streamOffset(d); ok {
+				last = offset
+				pending++
+			}
+			if pending >= sc.CommitEvery {
+				if err := commit(); err != nil {
+					return processed, fmt.Errorf("failed to save offset: %w", err)
+				}
+			}
+		}
+	}
+}
+
+func streamOffset(d amqp.Delivery) (int64, bool) {
+	switch v := d.Headers["x-stream-offset"].(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// SuperStreamPartitions returns the partition streams of a super stream, or
+// nil when partitions is not positive.
+func SuperStreamPartitions(name string, partitions int) []string {
+	if partitions <= 0 {
+		return nil
+	}
+	names := make([]string, partitions)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", name, i)
+	}
+	return names
+}
+
+func checkPartitions(partitions int) error {
+	if partitions <= 0 {
+		return fmt.Errorf("super stream partitions must be greater than zero, got %d", partitions)
+	}
+	return nil
+}
+
+// superStreamPartition returns the routing key of the partition for key.
+func superStreamPartition(key string, partitions int) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return strconv.Itoa(int(h.Sum32() % uint32(partitions)))
+}
+
+// DeclareSuperStream declares a super stream: a direct exchange routing to
+// partitions streams bound by partition index.
+func (r *ConnRabbitMQ) DeclareSuperStream(name string, partitions int, maxAge time.Duration, maxBytes int64) error {
+	if err := checkPartitions(partitions); err != nil {
+		return err
+	}
+	err := r.Channel.ExchangeDeclare(name, amqp.ExchangeDirect, true, false, false, false, amqp.Table{
+		"x-super-stream": true,
+	})
+	if err != nil {
+		return fmt.Errorf("falha ao declarar super stream %s: %w", name, err)
+	}
+	for i, partition := range SuperStreamPartitions(name, partitions) {
+		if err := r.DeclareStream(partition, maxAge, maxBytes); err != nil {
+			return err
+		}
+		err := r.Channel.QueueBind(partition, strconv.Itoa(i), name, false, amqp.Table{
+			"x-stream-partition-order": i,
+		})
+		if err != nil {
+			return fmt.Errorf("falha ao vincular partição %s: %w", partition, err)
+		}
+	}
+	return nil
+}
+
+// PublishSuperStream publishes data to the partition chosen by hashing key,
+// so messages with the same key keep their order.
+func (r *ConnRabbitMQ) PublishSuperStream(ctx context.Context, name string, partitions int, key string, data any) error {
+	if err := checkPartitions(partitions); err != nil {
+		return err
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize struct: %w", err)
+	}
+	partition := superStreamPartition(key, partitions)
+
+	err = r.Channel.PublishWithContext(ctx, name, partition, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+		Timestamp:    time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("falha ao publicar no super stream: %w", err)
+	}
+	return nil
+}
+
+// ConsumeSuperStream runs ConsumeStream for every partition of a super stream.
+// Offsets are tracked per partition.
+func (r *ConnRabbitMQ) ConsumeSuperStream(ctx context.Context, name string, partitions int, sc StreamConsumer, f HandlesRabbitMQ) error {
+	if err := checkPartitions(partitions); err != nil {
+		return err
+	}
+	errs := make(chan error, partitions)
+	for _, partition := range SuperStreamPartitions(name, partitions) {
+		psc := sc
+		psc.Stream = partition
+		go func() {
+			errs <- r.ConsumeStream(ctx, psc, f)
+		}()
+	}
+	var err error
+	for i := 0; i < partitions; i++ {
+		err = errors.Join(err, <-errs)
+	}
+	return err
+}
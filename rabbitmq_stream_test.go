@@ -0,0 +1,129 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestSuperStreamPartitions(t *testing.T) {
+	r := &ConnRabbitMQ{}
+	ctx := context.Background()
+	for _, partitions := range []int{0, -1} {
+		if err := r.PublishSuperStream(ctx, "pedidos", partitions, "cliente-1", "x"); err == nil {
+			t.Errorf("publicar com %d partições deveria falhar", partitions)
+		}
+		if err := r.DeclareSuperStream("pedidos", partitions, 0, 0); err == nil {
+			t.Errorf("declarar com %d partições deveria falhar", partitions)
+		}
+		if err := r.ConsumeSuperStream(ctx, "pedidos", partitions, StreamConsumer{}, nil); err == nil {
+			t.Errorf("consumir com %d partições deveria falhar", partitions)
+		}
+	}
+
+	if names := SuperStreamPartitions("pedidos", 3); len(names) != 3 || names[2] != "pedidos-2" {
+		t.Errorf("partições inesperadas: %v", names)
+	}
+	seen := map[string]bool{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		p := superStreamPartition(key, 3)
+		if p != superStreamPartition(key, 3) {
+			t.Fatalf("a mesma chave deveria ir sempre para a mesma partição")
+		}
+		seen[p] = true
+	}
+	for p := range seen {
+		if p != "0" && p != "1" && p != "2" {
+			t.Errorf("partição fora do intervalo: %s", p)
+		}
+	}
+}
+
+func TestRedisOffsetStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewRedisOffsetStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	if _, ok, err := store.LoadOffset(ctx, "pedidos-0", "faturamento"); ok || err != nil {
+		t.Errorf("offset não deveria existir: %v %v", ok, err)
+	}
+	if err := store.SaveOffset(ctx, "pedidos-0", "faturamento", 42); err != nil {
+		t.Fatal(err)
+	}
+	if offset, ok, err := store.LoadOffset(ctx, "pedidos-0", "faturamento"); !ok || err != nil || offset != 42 {
+		t.Errorf("esperava offset 42, recebeu %d %v %v", offset, ok, err)
+	}
+}
+
+func TestRestartStream(t *testing.T) {
+	r := &ConnRabbitMQ{}
+	sc := StreamConsumer{Stream: "pedidos", RestartDelay: time.Millisecond, MaxFailures: 3}
+	handlerErr := fmt.Errorf("%w: %w", errStreamHandler, errors.New("falhou"))
+
+	t.Run("desiste após falhas seguidas do handler", func(t *testing.T) {
+		calls := 0
+		err := r.restartStream(context.Background(), sc, func() (bool, error) {
+			calls++
+			return false, handlerErr
+		})
+		if !errors.Is(err, errStreamHandler) || calls != 3 {
+			t.Errorf("esperava o erro do handler após 3 tentativas, recebeu %v em %d", err, calls)
+		}
+	})
+
+	t.Run("mensagem processada zera as falhas", func(t *testing.T) {
+		calls := 0
+		err := r.restartStream(context.Background(), sc, func() (bool, error) {
+			calls++
+			return calls == 2, handlerErr
+		})
+		if err == nil || calls != 4 {
+			t.Errorf("esperava desistir na quarta tentativa, recebeu %v em %d", err, calls)
+		}
+	})
+
+	t.Run("erro de conexão não tem limite", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := r.restartStream(ctx, sc, func() (bool, error) {
+			if calls++; calls == 10 {
+				cancel()
+			}
+			return false, errors.New("connection is not open")
+		})
+		if err != nil || calls != 10 {
+			t.Errorf("esperava parar só pelo contexto, recebeu %v em %d", err, calls)
+		}
+	})
+
+	t.Run("espera respeita o contexto", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := sc
+		slow.RestartDelay = time.Hour
+		start := time.Now()
+		err := r.restartStream(ctx, slow, func() (bool, error) {
+			cancel()
+			return false, handlerErr
+		})
+		if err != nil || time.Since(start) > time.Second {
+			t.Errorf("esperava retorno imediato ao cancelar, recebeu %v em %s", err, time.Since(start))
+		}
+	})
+}
+
+func TestMemoryOffsetStore(t *testing.T) {
+	store := &memoryOffsetStore{}
+	ctx := context.Background()
+	if _, ok, _ := store.LoadOffset(ctx, "pedidos", "faturamento"); ok {
+		t.Error("offset não deveria existir")
+	}
+	store.SaveOffset(ctx, "pedidos", "faturamento", 7)
+	if offset, ok, _ := store.LoadOffset(ctx, "pedidos", "faturamento"); !ok || offset != 7 {
+		t.Errorf("esperava offset 7, recebeu %d %v", offset, ok)
+	}
+}
@@ -0,0 +1,39 @@
+package gorote
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// newTestRabbitMQ connects to the broker in RABBITMQ_URL, skipping the test
+// when it is not set.
+func newTestRabbitMQ(t *testing.T) *ConnRabbitMQ {
+	t.Helper()
+	url := os.Getenv("RABBITMQ_URL")
+	if url == "" {
+		t.Skip("RABBITMQ_URL não definida")
+	}
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		t.Fatalf("erro ao conectar no RabbitMQ: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Fatalf("erro ao abrir canal: %v", err)
+	}
+	return &ConnRabbitMQ{Connection: conn, Channel: ch}
+}
+
+// testQueue declares an exclusive queue removed with the connection.
+func testQueue(t *testing.T, r *ConnRabbitMQ) string {
+	t.Helper()
+	q, err := r.Channel.QueueDeclare("test-"+uuid.NewString(), false, true, true, false, nil)
+	if err != nil {
+		t.Fatalf("erro ao declarar fila: %v", err)
+	}
+	return q.Name
+}
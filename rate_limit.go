@@ -0,0 +1,304 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type RateLimitAlgorithm string
+
+const (
+	// RateLimitFixedWindow counts requests in consecutive windows.
+	RateLimitFixedWindow RateLimitAlgorithm = "fixed"
+	// RateLimitSlidingWindow weighs the previous window by how much of it
+	// still overlaps the last Window, smoothing bursts at window edges.
+	RateLimitSlidingWindow RateLimitAlgorithm = "sliding"
+	// RateLimitTokenBucket allows bursts of up to Max requests, refilled at
+	// Max per Window.
+	RateLimitTokenBucket RateLimitAlgorithm = "bucket"
+)
+
+// RateLimitKeyFunc identifies who a request is counted against.
+type RateLimitKeyFunc func(c *fiber.Ctx) string
+
+func KeyByIP() RateLimitKeyFunc {
+	return func(c *fiber.Ctx) string {
+		return "ip:" + c.IP()
+	}
+}
+
+// KeyByHeader keys requests by the value of header, or by IP when absent.
+func KeyByHeader(header string) RateLimitKeyFunc {
+	return func(c *fiber.Ctx) string {
+		if v := c.Get(header); v != "" {
+			return header + ":" + v
+		}
+		return "ip:" + c.IP()
+	}
+}
+
+// KeyByAPIKey keys requests by the X-API-Key header or the api_key query
+// parameter, or by IP when neither is present.
+func KeyByAPIKey() RateLimitKeyFunc {
+	return func(c *fiber.Ctx) string {
+		key := c.Get("X-API-Key")
+		if key == "" {
+			key = c.Query("api_key")
+		}
+		if key == "" {
+			return "ip:" + c.IP()
+		}
+		return "key:" + key
+	}
+}
+
+// KeyByJWTSubject keys requests by the subject of the claims stored by
+// JWTProtected, or by IP for anonymous requests.
+func KeyByJWTSubject() RateLimitKeyFunc {
+	return func(c *fiber.Ctx) string {
+		if claims, ok := c.Locals("claimsData").(jwt.Claims); ok {
+			if sub, err := claims.GetSubject(); err == nil && sub != "" {
+				return "sub:" + sub
+			}
+		}
+		return "ip:" + c.IP()
+	}
+}
+
+type RateLimitConfig struct {
+	// Max requests per Window. Defaults to 60.
+	Max int
+	// MaxFunc, when set, returns the limit for a request, e.g. from the
+	// plan of the caller. Values below 1 fall back to Max.
+	MaxFunc func(c *fiber.Ctx) int
+	// Window defaults to one minute; shorter windows are raised to a
+	// millisecond.
+	Window time.Duration
+	// Algorithm defaults to RateLimitSlidingWindow.
+	Algorithm RateLimitAlgorithm
+	// Key defaults to KeyByIP.
+	Key RateLimitKeyFunc
+	// Storage defaults to a MemoryStorage. With an AtomicStorage such as
+	// RedisStorage updates are atomic across replicas.
+	Storage fiber.Storage
+	// Prefix namespaces the counters; give each route tier its own when
+	// they share a storage. Defaults to "ratelimit:".
+	Prefix string
+	// Next skips the limiter when it returns true.
+	Next func(c *fiber.Ctx) bool
+	// LimitReached defaults to returning fiber.ErrTooManyRequests.
+	LimitReached fiber.Handler
+	// DisableHeaders omits the RateLimit-* headers on allowed requests.
+	DisableHeaders bool
+}
+
+// rateState is the stored state of a key for every algorithm.
+type rateState struct {
+	Start  int64   `json:"s,omitempty"`
+	Count  int     `json:"c,omitempty"`
+	Prev   int     `json:"p,omitempty"`
+	Tokens float64 `json:"t,omitempty"`
+}
+
+type rateResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// RateLimit limits requests per key with the configured algorithm and sets
+// the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, plus
+// Retry-After when the limit is reached.
+func RateLimit(config RateLimitConfig) fiber.Handler {
+	if config.Max <= 0 {
+		config.Max = 60
+	}
+	if config.Window == 0 {
+		config.Window = time.Minute
+	}
+	if config.Window < time.Millisecond {
+		config.Window = time.Millisecond
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = RateLimitSlidingWindow
+	}
+	if config.Key == nil {
+		config.Key = KeyByIP()
+	}
+	if config.Storage == nil {
+		config.Storage = NewMemoryStorage()
+	}
+	if config.Prefix == "" {
+		config.Prefix = "ratelimit:"
+	}
+	if config.LimitReached == nil {
+		config.LimitReached = func(c *fiber.Ctx) error {
+			return fiber.ErrTooManyRequests
+		}
+	}
+	store := newRateStore(config.Storage)
+
+	return func(c *fiber.Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+		limit := config.Max
+		if config.MaxFunc != nil {
+			if n := config.MaxFunc(c); n > 0 {
+				limit = n
+			}
+		}
+
+		var result rateResult
+		err := store.update(c.UserContext(), config.Prefix+config.Key(c), 2*config.Window, func(raw []byte) ([]byte, error) {
+			var state rateState
+			if len(raw) > 0 {
+				if err := json.Unmarshal(raw, &state); err != nil {
+					return nil, fmt.Errorf("invalid rate limit state: %w", err)
+				}
+			}
+			result = config.Algorithm.take(&state, time.Now(), limit, config.Window)
+			return json.Marshal(state)
+		})
+		if err != nil {
+			return err
+		}
+
+		if !config.DisableHeaders || !result.allowed {
+			c.Set("RateLimit-Limit", strconv.Itoa(limit))
+			c.Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+			c.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+		}
+		if !result.allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.retryAfter)))
+			return config.LimitReached(c)
+		}
+		return c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// take counts a request against state and reports whether it is allowed.
+func (a RateLimitAlgorithm) take(state *rateState, now time.Time, limit int, window time.Duration) rateResult {
+	nowMs, windowMs := now.UnixMilli(), window.Milliseconds()
+	switch a {
+	case RateLimitTokenBucket:
+		rate := float64(limit) / float64(windowMs)
+		if state.Start == 0 {
+			state.Tokens = float64(limit)
+		} else {
+			state.Tokens = math.Min(float64(limit), state.Tokens+float64(nowMs-state.Start)*rate)
+		}
+		state.Start = nowMs
+		result := rateResult{allowed: state.Tokens >= 1}
+		if result.allowed {
+			state.Tokens--
+		} else {
+			result.retryAfter = time.Duration((1-state.Tokens)/rate) * time.Millisecond
+		}
+		result.remaining = int(state.Tokens)
+		result.reset = time.Duration((float64(limit)-state.Tokens)/rate) * time.Millisecond
+		return result
+
+	case RateLimitFixedWindow:
+		if nowMs >= state.Start+windowMs {
+			state.Start, state.Count = nowMs, 0
+		}
+		reset := time.Duration(state.Start+windowMs-nowMs) * time.Millisecond
+		if state.Count >= limit {
+			return rateResult{reset: reset, retryAfter: reset}
+		}
+		state.Count++
+		return rateResult{allowed: true, remaining: limit - state.Count, reset: reset}
+
+	default:
+		// Windows are aligned to multiples of window, so the previous one
+		// is only kept when it is the adjacent window.
+		start := nowMs - nowMs%windowMs
+		switch {
+		case start == state.Start+windowMs:
+			state.Prev, state.Count = state.Count, 0
+		case start != state.Start:
+			state.Prev, state.Count = 0, 0
+		}
+		state.Start = start
+		elapsed := nowMs - start
+		weight := float64(windowMs-elapsed) / float64(windowMs)
+		estimate := float64(state.Prev)*weight + float64(state.Count)
+		reset := time.Duration(windowMs-elapsed) * time.Millisecond
+
+		if estimate+1 > float64(limit) {
+			retry := reset
+			if state.Count+1 <= limit && state.Prev > 0 {
+				// Wait until enough of the previous window slides out.
+				needed := 1 - float64(limit-state.Count-1)/float64(state.Prev)
+				retry = time.Duration(needed*float64(windowMs)-float64(elapsed)) * time.Millisecond
+			}
+			return rateResult{remaining: 0, reset: reset, retryAfter: max(retry, time.Millisecond)}
+		}
+		state.Count++
+		return rateResult{allowed: true, remaining: max(0, int(float64(limit)-estimate-1)), reset: reset}
+	}
+}
+
+// AtomicStorage is a fiber.Storage that applies read-modify-write updates
+// atomically, such as RedisStorage. RateLimit uses Update when the storage
+// implements it, so counters are exact across replicas.
+type AtomicStorage interface {
+	fiber.Storage
+	// Update stores the value fn returns for the current one, which is nil
+	// when key does not exist. An error from fn aborts the update.
+	Update(ctx context.Context, key string, exp time.Duration, fn func([]byte) ([]byte, error)) error
+}
+
+// rateStore applies read-modify-write updates to a fiber.Storage.
+type rateStore interface {
+	update(ctx context.Context, key string, ttl time.Duration, fn func([]byte) ([]byte, error)) error
+}
+
+func newRateStore(storage fiber.Storage) rateStore {
+	if s, ok := storage.(AtomicStorage); ok {
+		return atomicRateStore{s}
+	}
+	return &localRateStore{storage: storage}
+}
+
+// localRateStore serializes updates within the process only.
+type localRateStore struct {
+	mu      sync.Mutex
+	storage fiber.Storage
+}
+
+func (s *localRateStore) update(_ context.Context, key string, ttl time.Duration, fn func([]byte) ([]byte, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	raw, err := s.storage.Get(key)
+	if err != nil {
+		return err
+	}
+	updated, err := fn(raw)
+	if err != nil {
+		return err
+	}
+	return s.storage.Set(key, updated, ttl)
+}
+
+type atomicRateStore struct {
+	storage AtomicStorage
+}
+
+func (s atomicRateStore) update(ctx context.Context, key string, ttl time.Duration, fn func([]byte) ([]byte, error)) error {
+	return s.storage.Update(ctx, key, ttl, fn)
+}
@@ -0,0 +1,151 @@
+package gorote
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRateLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	storage := NewRedisStorage(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "app:")
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if sub := c.Get("X-Sub"); sub != "" {
+			c.Locals("claimsData", &jwt.RegisteredClaims{Subject: sub})
+		}
+		return c.Next()
+	})
+	app.Use(RateLimit(RateLimitConfig{
+		Max:     2,
+		Window:  time.Hour,
+		Key:     KeyByJWTSubject(),
+		Storage: storage,
+		MaxFunc: func(c *fiber.Ctx) int {
+			if c.Get("X-Sub") == "premium" {
+				return 3
+			}
+			return 0
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	request := func(sub string) (int, string, string) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Sub", sub)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, resp.Header.Get("RateLimit-Remaining"), resp.Header.Get(fiber.HeaderRetryAfter)
+	}
+
+	t.Run("limite por sujeito do JWT", func(t *testing.T) {
+		if code, remaining, _ := request("ana"); code != 200 || remaining != "1" {
+			t.Errorf("esperava 200 com 1 restante, recebeu %d %s", code, remaining)
+		}
+		request("ana")
+		code, remaining, retry := request("ana")
+		if code != fiber.StatusTooManyRequests || remaining != "0" || retry == "" {
+			t.Errorf("esperava 429 com Retry-After, recebeu %d %s %q", code, remaining, retry)
+		}
+		if code, _, _ := request("bia"); code != 200 {
+			t.Errorf("outro sujeito não deveria ser limitado, recebeu %d", code)
+		}
+		if !mr.Exists("app:ratelimit:sub:ana") {
+			t.Error("contador deveria estar no redis")
+		}
+	})
+
+	t.Run("limite dinâmico por plano", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if code, _, _ := request("premium"); code != 200 {
+				t.Fatalf("requisição %d do plano premium deveria passar, recebeu %d", i+1, code)
+			}
+		}
+		if code, _, _ := request("premium"); code != fiber.StatusTooManyRequests {
+			t.Errorf("esperava 429 após o limite do plano, recebeu %d", code)
+		}
+	})
+
+	t.Run("estado inválido retorna erro", func(t *testing.T) {
+		mr.Set("app:ratelimit:sub:carla", "{")
+		if code, _, _ := request("carla"); code != fiber.StatusInternalServerError {
+			t.Errorf("esperava 500 com estado corrompido, recebeu %d", code)
+		}
+	})
+
+	t.Run("janela menor que 1ms vira 1ms", func(t *testing.T) {
+		app := fiber.New()
+		app.Use(RateLimit(RateLimitConfig{Max: 1, Window: time.Microsecond, Algorithm: RateLimitFixedWindow}))
+		app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+		for i := 0; i < 2; i++ {
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil || resp.StatusCode != 200 {
+				t.Fatalf("requisição %d deveria passar em uma nova janela, recebeu %v %v", i+1, resp.StatusCode, err)
+			}
+			if reset := resp.Header.Get("RateLimit-Reset"); reset != "1" {
+				t.Errorf("esperava RateLimit-Reset 1, recebeu %q", reset)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
+
+// wrappedStorage hides the concrete type of a RedisStorage.
+type wrappedStorage struct {
+	*RedisStorage
+}
+
+func TestRateLimitAtomicStorage(t *testing.T) {
+	mr := miniredis.RunT(t)
+	var storage fiber.Storage = wrappedStorage{NewRedisStorage(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "app:")}
+	if _, ok := newRateStore(storage).(atomicRateStore); !ok {
+		t.Errorf("storage com Update deveria usar atualização atômica")
+	}
+	if _, ok := newRateStore(NewMemoryStorage()).(*localRateStore); !ok {
+		t.Errorf("storage sem Update deveria usar o mutex local")
+	}
+}
+
+func TestRateLimitAlgorithms(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("token bucket reabastece", func(t *testing.T) {
+		var state rateState
+		for i := 0; i < 2; i++ {
+			if r := RateLimitTokenBucket.take(&state, now, 2, time.Minute); !r.allowed {
+				t.Fatalf("requisição %d deveria passar", i+1)
+			}
+		}
+		r := RateLimitTokenBucket.take(&state, now, 2, time.Minute)
+		if r.allowed || r.retryAfter != 30*time.Second {
+			t.Errorf("esperava bloqueio por 30s, recebeu %v %s", r.allowed, r.retryAfter)
+		}
+		if r := RateLimitTokenBucket.take(&state, now.Add(30*time.Second), 2, time.Minute); !r.allowed {
+			t.Error("esperava um token após 30s")
+		}
+	})
+
+	t.Run("janela deslizante pondera a janela anterior", func(t *testing.T) {
+		var state rateState
+		for i := 0; i < 4; i++ {
+			RateLimitSlidingWindow.take(&state, now.Add(50*time.Second), 4, time.Minute)
+		}
+		// 15s into the next window, 75% of the previous 4 requests still count.
+		r := RateLimitSlidingWindow.take(&state, now.Add(75*time.Second), 4, time.Minute)
+		if !r.allowed {
+			t.Fatal("esperava uma requisição liberada")
+		}
+		r = RateLimitSlidingWindow.take(&state, now.Add(75*time.Second), 4, time.Minute)
+		if r.allowed || r.retryAfter != 15*time.Second {
+			t.Errorf("esperava bloqueio por 15s, recebeu %v %s", r.allowed, r.retryAfter)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrLockNotAcquired = errors.New("lock not acquired")
+	// ErrLockLost is returned when the lock expired or was taken by another
+	// holder before being refreshed or released.
+	ErrLockLost = errors.New("lock lost")
+)
+
+var refreshLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisLock is a lease on a Redis key identified by a random token, so only
+// its holder can refresh or release it. The lease is renewed in the
+// background every TTL/3 until Release; Context is cancelled if a renewal
+// finds the lock lost.
+type RedisLock struct {
+	Redis *redis.Client
+	Key   string
+	Token string
+	TTL   time.Duration
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// AcquireLock tries once to take the lock on key for ttl and returns
+// ErrLockNotAcquired when someone else holds it.
+func AcquireLock(ctx context.Context, client *redis.Client, key string, ttl time.Duration) (*RedisLock, error) {
+	token := uuid.NewString()
+	ok, err := client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+
+	l := &RedisLock{Redis: client, Key: key, Token: token, TTL: ttl, stopped: make(chan struct{})}
+	l.ctx, l.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	go l.keepAlive()
+	return l, nil
+}
+
+// ObtainLock waits for the lock on key, retrying every retry, until it is
+// acquired or ctx is done.
+func ObtainLock(ctx context.Context, client *redis.Client, key string, ttl, retry time.Duration) (*RedisLock, error) {
+	for {
+		l, err := AcquireLock(ctx, client, key, ttl)
+		if !errors.Is(err, ErrLockNotAcquired) {
+			return l, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+// WithLock runs fn while holding the lock on key. The context passed to fn is
+// cancelled if the lock is lost. It returns ErrLockNotAcquired without
+// running fn when the lock is held elsewhere.
+func WithLock(ctx context.Context, client *redis.Client, key string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	l, err := AcquireLock(ctx, client, key, ttl)
+	if err != nil {
+		return err
+	}
+	defer l.Release(context.WithoutCancel(ctx))
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(l.Context(), cancel)
+	defer stop()
+	return fn(runCtx)
+}
+
+// Context is cancelled when the lock is released or lost.
+func (l *RedisLock) Context() context.Context {
+	return l.ctx
+}
+
+func (l *RedisLock) keepAlive() {
+	defer close(l.stopped)
+	ticker := time.NewTicker(l.TTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := l.Refresh(l.ctx); err != nil {
+			if l.ctx.Err() != nil {
+				return
+			}
+			log.Printf("[Redis] Lock %s perdido: %v", l.Key, err)
+			l.cancel()
+			return
+		}
+	}
+}
+
+// Refresh extends the lease by TTL.
+func (l *RedisLock) Refresh(ctx context.Context) error {
+	n, err := refreshLockScript.Run(ctx, l.Redis, []string{l.Key}, l.Token, l.TTL.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to refresh lock %s: %w", l.Key, err)
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Release stops the renewal and deletes the key if the lock is still held.
+func (l *RedisLock) Release(ctx context.Context) error {
+	var err error
+	l.once.Do(func() {
+		l.cancel()
+		<-l.stopped
+		var n int
+		n, err = releaseLockScript.Run(ctx, l.Redis, []string{l.Key}, l.Token).Int()
+		if err != nil {
+			err = fmt.Errorf("failed to release lock %s: %w", l.Key, err)
+		} else if n == 0 {
+			err = ErrLockLost
+		}
+	})
+	return err
+}
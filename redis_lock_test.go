@@ -0,0 +1,93 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRedisLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	lock, err := AcquireLock(ctx, client, "lock:relatorio", time.Second)
+	if err != nil {
+		t.Fatalf("erro ao adquirir lock: %v", err)
+	}
+	if _, err := AcquireLock(ctx, client, "lock:relatorio", time.Second); !errors.Is(err, ErrLockNotAcquired) {
+		t.Errorf("esperava ErrLockNotAcquired, recebeu: %v", err)
+	}
+
+	t.Run("outro token não libera o lock", func(t *testing.T) {
+		other := &RedisLock{Redis: client, Key: "lock:relatorio", Token: "outro", TTL: time.Second}
+		if err := other.Refresh(ctx); !errors.Is(err, ErrLockLost) {
+			t.Errorf("esperava ErrLockLost, recebeu: %v", err)
+		}
+		if !mr.Exists("lock:relatorio") {
+			t.Error("lock não deveria ser removido")
+		}
+	})
+
+	t.Run("lock perdido cancela o contexto", func(t *testing.T) {
+		mr.Set("lock:relatorio", "outro")
+		select {
+		case <-lock.Context().Done():
+		case <-time.After(2 * time.Second):
+			t.Fatal("contexto do lock não foi cancelado")
+		}
+		if err := lock.Release(ctx); !errors.Is(err, ErrLockLost) {
+			t.Errorf("esperava ErrLockLost ao liberar, recebeu: %v", err)
+		}
+		if got, _ := mr.Get("lock:relatorio"); got != "outro" {
+			t.Errorf("release não deveria remover lock de outro dono")
+		}
+	})
+}
+
+func TestLeaderElection(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	elected := make(chan string, 2)
+	newElection := func(name string) *LeaderElection {
+		e := NewLeaderElection(client, "leader:cron")
+		e.RetryInterval = 10 * time.Millisecond
+		e.OnElected = func(ctx context.Context) { elected <- name }
+		return e
+	}
+	a, b := newElection("a"), newElection("b")
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() {
+		a.Run(ctxA)
+		close(doneA)
+	}()
+	if first := <-elected; first != "a" {
+		t.Fatalf("esperava a como líder, recebeu %s", first)
+	}
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	go b.Run(ctxB)
+	time.Sleep(50 * time.Millisecond)
+	if b.IsLeader() {
+		t.Fatal("b não deveria ser líder enquanto a lidera")
+	}
+
+	cancelA()
+	<-doneA
+	select {
+	case next := <-elected:
+		if next != "b" || a.IsLeader() {
+			t.Errorf("esperava b como novo líder, recebeu %s", next)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("b não assumiu a liderança")
+	}
+}
@@ -0,0 +1,124 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisStorage implements fiber.Storage over a Redis client, so middlewares
+// such as Limited and Cached share their state across replicas. Every key is
+// stored under Prefix. Limited does not update counters atomically, so it may
+// let a few extra requests through under concurrency; RateLimit uses Update
+// and is exact.
+type RedisStorage struct {
+	Redis  *redis.Client
+	Prefix string
+	// Timeout bounds each Redis call, since fiber.Storage has no context.
+	Timeout time.Duration
+}
+
+func NewRedisStorage(client *redis.Client, prefix string) *RedisStorage {
+	return &RedisStorage{Redis: client, Prefix: prefix, Timeout: time.Second}
+}
+
+func (s *RedisStorage) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.Timeout)
+}
+
+// Get returns nil without error when key does not exist.
+func (s *RedisStorage) Get(key string) ([]byte, error) {
+	if key == "" {
+		return nil, nil
+	}
+	ctx, cancel := s.context()
+	defer cancel()
+	val, err := s.Redis.Get(ctx, s.Prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return val, err
+}
+
+// Set stores val under key; exp of zero means no expiration.
+func (s *RedisStorage) Set(key string, val []byte, exp time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.Redis.Set(ctx, s.Prefix+key, val, exp).Err()
+}
+
+func (s *RedisStorage) Delete(key string) error {
+	if key == "" {
+		return nil
+	}
+	ctx, cancel := s.context()
+	defer cancel()
+	return s.Redis.Del(ctx, s.Prefix+key).Err()
+}
+
+// Reset deletes every key under Prefix. With an empty prefix it would wipe
+// unrelated data, so it refuses to run.
+func (s *RedisStorage) Reset() error {
+	if s.Prefix == "" {
+		return errors.New("refusing to reset redis storage without prefix")
+	}
+	ctx := context.Background()
+	iter := s.Redis.Scan(ctx, 0, s.Prefix+"*", 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 100 {
+			if err := s.Redis.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return s.Redis.Del(ctx, keys...).Err()
+	}
+	return nil
+}
+
+// Update applies fn to the value under key with WATCH/MULTI, retrying when
+// another client changes the key meanwhile, so concurrent replicas never lose
+// updates.
+func (s *RedisStorage) Update(ctx context.Context, key string, exp time.Duration, fn func([]byte) ([]byte, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	key = s.Prefix + key
+	for attempt := 0; attempt < 10; attempt++ {
+		err := s.Redis.Watch(ctx, func(tx *redis.Tx) error {
+			raw, err := tx.Get(ctx, key).Bytes()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			updated, err := fn(raw)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, updated, exp)
+				return nil
+			})
+			return err
+		}, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return errors.New("redis storage update contended")
+}
+
+// Close does not close the client, which is usually shared.
+func (s *RedisStorage) Close() error {
+	return nil
+}
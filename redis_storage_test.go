@@ -0,0 +1,93 @@
+package gorote
+
+import (
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRedisStorage(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	storage := NewRedisStorage(client, "app:")
+
+	if err := storage.Set("chave", []byte("valor"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := storage.Get("chave"); err != nil || string(got) != "valor" {
+		t.Errorf("esperava valor, recebeu %q %v", got, err)
+	}
+	if ttl := mr.TTL("app:chave"); ttl != time.Minute {
+		t.Errorf("esperava TTL de 1 minuto, recebeu %s", ttl)
+	}
+	if got, err := storage.Get("inexistente"); got != nil || err != nil {
+		t.Errorf("esperava nil para chave inexistente, recebeu %q %v", got, err)
+	}
+
+	mr.Set("outra", "x")
+	if err := storage.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("app:chave") || !mr.Exists("outra") {
+		t.Error("reset deveria remover apenas as chaves com prefixo")
+	}
+}
+
+func TestLimitedSharedStorage(t *testing.T) {
+	mr := miniredis.RunT(t)
+	storage := NewRedisStorage(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "limiter:")
+
+	newApp := func() *fiber.App {
+		app := fiber.New()
+		app.Use(Limited(2, storage))
+		app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+		return app
+	}
+	replicas := []*fiber.App{newApp(), newApp(), newApp()}
+
+	var codes []int
+	for _, app := range replicas {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes = append(codes, resp.StatusCode)
+	}
+	if codes[0] != 200 || codes[1] != 200 || codes[2] != fiber.StatusTooManyRequests {
+		t.Errorf("limite deveria ser compartilhado entre réplicas, recebeu %v", codes)
+	}
+}
+
+func TestLimitedConcurrentReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	storage := NewRedisStorage(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "limiter:")
+	replicas := make([]*fiber.App, 4)
+	for i := range replicas {
+		replicas[i] = fiber.New()
+		replicas[i].Use(Limited(5, storage))
+		replicas[i].Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	}
+
+	var wg sync.WaitGroup
+	var passed atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := replicas[i%len(replicas)].Test(httptest.NewRequest("GET", "/", nil))
+			if err == nil && resp.StatusCode == 200 {
+				passed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := passed.Load(); n != 5 {
+		t.Errorf("esperava exatamente 5 requisições aceitas entre as réplicas, passaram %d", n)
+	}
+}
@@ -0,0 +1,390 @@
+package gorote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+)
+
+const cacheTagsLocal = "cacheTags"
+
+// CacheKeyFunc returns one component of a response cache key.
+type CacheKeyFunc func(c *fiber.Ctx) string
+
+// CacheKeyUser keys responses by the subject of the claims stored by
+// JWTProtected, so authenticated users never see each other's responses.
+func CacheKeyUser() CacheKeyFunc {
+	return func(c *fiber.Ctx) string {
+		if claims, ok := c.Locals("claimsData").(jwt.Claims); ok {
+			if sub, err := claims.GetSubject(); err == nil {
+				return sub
+			}
+		}
+		return ""
+	}
+}
+
+// CacheKeyHeader keys responses by a request header, e.g. X-Tenant-ID.
+func CacheKeyHeader(header string) CacheKeyFunc {
+	return func(c *fiber.Ctx) string {
+		return c.Get(header)
+	}
+}
+
+// CacheKeyLocal keys responses by a value stored in the locals by an earlier
+// middleware, e.g. the tenant resolved from the host.
+func CacheKeyLocal(key string) CacheKeyFunc {
+	return func(c *fiber.Ctx) string {
+		if v := c.Locals(key); v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+}
+
+type ResponseCacheConfig struct {
+	// TTL is how long a response is served as fresh. Defaults to one minute.
+	TTL time.Duration
+	// StaleWhileRevalidate is how long after TTL a response is still served
+	// while it is refreshed in the background.
+	StaleWhileRevalidate time.Duration
+	// Key composes the cache key beyond method, path and query. Without it,
+	// requests with an Authorization header or JWT claims are not cached, so
+	// set it, e.g. to CacheKeyUser, to cache authenticated routes. Requests
+	// for which a component is empty bypass the cache, so mount the cache
+	// after the middleware that sets what the components read.
+	Key []CacheKeyFunc
+	// Vary lists request headers that select different representations.
+	// They are added to the key and to the Vary response header. Vary
+	// headers set by the handler are honored as well.
+	Vary []string
+	// Tags returns the tags of a response before the handler runs. Handlers
+	// can add more with CacheTags.
+	Tags func(c *fiber.Ctx) []string
+	// Storage defaults to a MemoryStorage.
+	Storage fiber.Storage
+	// Prefix namespaces the entries. Defaults to "cache:".
+	Prefix string
+	// Next skips the cache when it returns true.
+	Next func(c *fiber.Ctx) bool
+}
+
+// ResponseCache caches GET responses per composed key and invalidates them by
+// tag. Tags are versioned in the storage, so invalidation works on any
+// fiber.Storage and, with a RedisStorage, across replicas.
+type ResponseCache struct {
+	config ResponseCacheConfig
+	// token marks background revalidation requests so they skip the lookup.
+	token        string
+	revalidating sync.Map
+}
+
+type cacheEntry struct {
+	Status  int                 `json:"status"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    []byte              `json:"body,omitempty"`
+	Stored  int64               `json:"stored"`
+	Tags    map[string]string   `json:"tags,omitempty"`
+}
+
+type cacheTagging struct {
+	cache    *ResponseCache
+	versions map[string]string
+}
+
+func NewResponseCache(config ResponseCacheConfig) *ResponseCache {
+	if config.TTL <= 0 {
+		config.TTL = time.Minute
+	}
+	if config.Storage == nil {
+		config.Storage = NewMemoryStorage()
+	}
+	if config.Prefix == "" {
+		config.Prefix = "cache:"
+	}
+	for i, h := range config.Vary {
+		config.Vary[i] = http.CanonicalHeaderKey(h)
+	}
+	return &ResponseCache{config: config, token: uuid.NewString()}
+}
+
+// CacheTags tags the response being cached, so ResponseCache.Invalidate with
+// any of the tags evicts it. Call it before loading the data the response is
+// built from. It is a no-op outside a ResponseCache.
+func CacheTags(c *fiber.Ctx, tags ...string) {
+	if tagging, ok := c.Locals(cacheTagsLocal).(*cacheTagging); ok {
+		tagging.add(tags...)
+	}
+}
+
+func (t *cacheTagging) add(tags ...string) {
+	for _, tag := range tags {
+		if _, ok := t.versions[tag]; !ok {
+			t.versions[tag] = t.cache.tagVersion(tag)
+		}
+	}
+}
+
+// Invalidate evicts every response tagged with any of tags. Call it from
+// write handlers after the change is committed.
+func (rc *ResponseCache) Invalidate(tags ...string) error {
+	for _, tag := range tags {
+		if err := rc.config.Storage.Set(rc.tagKey(tag), []byte(uuid.NewString()), rc.lifetime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Invalidates returns a middleware that invalidates tags after the route
+// succeeds.
+func (rc *ResponseCache) Invalidates(tags ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+		if c.Response().StatusCode() < fiber.StatusBadRequest {
+			return rc.Invalidate(tags...)
+		}
+		return nil
+	}
+}
+
+// lifetime is how long entries, vary records and tag versions are kept. A
+// tag version may expire with it since every entry it guards has too.
+func (rc *ResponseCache) lifetime() time.Duration {
+	return rc.config.TTL + rc.config.StaleWhileRevalidate
+}
+
+func (rc *ResponseCache) tagKey(tag string) string {
+	return rc.config.Prefix + "tag:" + tag
+}
+
+func (rc *ResponseCache) tagVersion(tag string) string {
+	v, _ := rc.config.Storage.Get(rc.tagKey(tag))
+	return string(v)
+}
+
+// Handler serves cached GET responses, setting X-Cache to HIT, STALE or MISS.
+// Responses other than 2xx, with Set-Cookie or Cache-Control: no-store are
+// not stored.
+func (rc *ResponseCache) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet || (rc.config.Next != nil && rc.config.Next(c)) || rc.private(c) {
+			return c.Next()
+		}
+		// A Key component is empty when, for instance, the claims are only set
+		// by a middleware after this one: the entry of someone else must not
+		// be served, so the lookup is skipped.
+		base, keyed := rc.baseKey(c)
+		revalidation := c.Get("X-Cache-Revalidate") == rc.token
+
+		vary := rc.config.Vary
+		if raw, _ := rc.config.Storage.Get(base + ":vary"); len(raw) > 0 {
+			vary = strings.Split(string(raw), ",")
+		}
+		if keyed && !revalidation {
+			if entry := rc.lookup(rc.variantKey(c, base, vary)); entry != nil {
+				age := time.Since(time.Unix(0, entry.Stored))
+				state := "HIT"
+				if age >= rc.config.TTL {
+					state = "STALE"
+					rc.revalidate(c, base)
+				}
+				c.Set("X-Cache", state)
+				c.Set(fiber.HeaderAge, strconv.Itoa(int(age.Seconds())))
+				return rc.serve(c, entry)
+			}
+		}
+
+		tagging := &cacheTagging{cache: rc, versions: map[string]string{}}
+		if rc.config.Tags != nil {
+			tagging.add(rc.config.Tags(c)...)
+		}
+		c.Locals(cacheTagsLocal, tagging)
+		start := time.Now()
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+		if len(rc.config.Vary) > 0 {
+			c.Vary(rc.config.Vary...)
+		}
+		c.Set("X-Cache", "MISS")
+
+		resp := c.Response()
+		status := resp.StatusCode()
+		// Claims may be set by a middleware running after this one, so the
+		// key is composed again and the response is only stored when it is
+		// complete.
+		base, keyed = rc.baseKey(c)
+		if !keyed || rc.private(c) || status < 200 || status >= 300 || status == fiber.StatusPartialContent ||
+			len(resp.Header.Peek(fiber.HeaderSetCookie)) > 0 ||
+			strings.Contains(string(resp.Header.Peek(fiber.HeaderCacheControl)), "no-store") {
+			return nil
+		}
+		vary = rc.responseVary(c)
+		if len(vary) == 1 && vary[0] == "*" {
+			return nil
+		}
+
+		entry := cacheEntry{
+			Status:  status,
+			Headers: map[string][]string{},
+			Body:    append([]byte(nil), resp.Body()...),
+			Stored:  start.UnixNano(),
+			Tags:    tagging.versions,
+		}
+		resp.Header.VisitAll(func(k, v []byte) {
+			switch key := string(k); key {
+			case fiber.HeaderContentLength, fiber.HeaderDate, fiber.HeaderAge, "X-Cache":
+			default:
+				entry.Headers[key] = append(entry.Headers[key], string(v))
+			}
+		})
+		if err := rc.store(base, rc.variantKey(c, base, vary), vary, entry); err != nil {
+			log.Printf("[Cache] Erro ao armazenar resposta de %s: %v", c.Path(), err)
+		}
+		return nil
+	}
+}
+
+// private reports whether the request is authenticated while no Key tells
+// users apart, in which case the response must not be shared.
+func (rc *ResponseCache) private(c *fiber.Ctx) bool {
+	if len(rc.config.Key) > 0 {
+		return false
+	}
+	return c.Get(fiber.HeaderAuthorization) != "" || c.Locals("claimsData") != nil
+}
+
+// baseKey identifies a resource, before Vary headers select a variant. The
+// query parameters are sorted so their order does not matter. keyed is false
+// when a Key component is empty.
+func (rc *ResponseCache) baseKey(c *fiber.Ctx) (key string, keyed bool) {
+	var params []string
+	c.Request().URI().QueryArgs().VisitAll(func(k, v []byte) {
+		params = append(params, string(k)+"="+string(v))
+	})
+	sort.Strings(params)
+
+	h := sha256.New()
+	h.Write([]byte(c.Method() + " " + c.Path() + "?" + strings.Join(params, "&")))
+	keyed = true
+	for _, component := range rc.config.Key {
+		v := component(c)
+		if v == "" {
+			keyed = false
+		}
+		h.Write([]byte{0})
+		h.Write([]byte(v))
+	}
+	return rc.config.Prefix + hex.EncodeToString(h.Sum(nil)), keyed
+}
+
+func (rc *ResponseCache) variantKey(c *fiber.Ctx, base string, vary []string) string {
+	if len(vary) == 0 {
+		return base
+	}
+	h := sha256.New()
+	for _, header := range vary {
+		h.Write([]byte(header + ":" + c.Get(header) + "\n"))
+	}
+	return base + ":" + hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// responseVary merges the configured headers with those the handler varied on.
+func (rc *ResponseCache) responseVary(c *fiber.Ctx) []string {
+	seen := map[string]bool{}
+	var vary []string
+	for _, v := range strings.Split(string(c.Response().Header.Peek(fiber.HeaderVary)), ",") {
+		if v = http.CanonicalHeaderKey(strings.TrimSpace(v)); v == "*" {
+			return []string{"*"}
+		} else if v != "" && !seen[v] {
+			seen[v] = true
+			vary = append(vary, v)
+		}
+	}
+	sort.Strings(vary)
+	return vary
+}
+
+// lookup returns the entry under key unless it is missing, past its stale
+// period or one of its tags was invalidated after it was stored.
+func (rc *ResponseCache) lookup(key string) *cacheEntry {
+	raw, err := rc.config.Storage.Get(key)
+	if err != nil || len(raw) == 0 {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil
+	}
+	if time.Since(time.Unix(0, entry.Stored)) >= rc.lifetime() {
+		return nil
+	}
+	for tag, version := range entry.Tags {
+		if rc.tagVersion(tag) != version {
+			return nil
+		}
+	}
+	return &entry
+}
+
+func (rc *ResponseCache) store(base, key string, vary []string, entry cacheEntry) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if len(vary) > 0 {
+		if err := rc.config.Storage.Set(base+":vary", []byte(strings.Join(vary, ",")), rc.lifetime()); err != nil {
+			return err
+		}
+	}
+	return rc.config.Storage.Set(key, raw, rc.lifetime())
+}
+
+func (rc *ResponseCache) serve(c *fiber.Ctx, entry *cacheEntry) error {
+	for k, values := range entry.Headers {
+		c.Response().Header.Del(k)
+		for _, v := range values {
+			c.Response().Header.Add(k, v)
+		}
+	}
+	c.Status(entry.Status)
+	return c.Send(entry.Body)
+}
+
+// revalidate replays the request through the app in the background, once per
+// resource at a time, so the next request finds a fresh entry.
+func (rc *ResponseCache) revalidate(c *fiber.Ctx, base string) {
+	if _, running := rc.revalidating.LoadOrStore(base, struct{}{}); running {
+		return
+	}
+	req := fasthttp.AcquireRequest()
+	c.Request().CopyTo(req)
+	req.Header.Set("X-Cache-Revalidate", rc.token)
+	remote := c.Context().RemoteAddr()
+	handler := c.App().Handler()
+
+	go func() {
+		defer rc.revalidating.Delete(base)
+		defer fasthttp.ReleaseRequest(req)
+		var ctx fasthttp.RequestCtx
+		ctx.Init(req, remote, nil)
+		handler(&ctx)
+	}()
+}
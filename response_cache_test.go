@@ -0,0 +1,182 @@
+package gorote
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestResponseCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	storages := map[string]fiber.Storage{
+		"memória": NewMemoryStorage(),
+		"redis":   NewRedisStorage(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "app:"),
+	}
+
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			var calls atomic.Int32
+			rc := NewResponseCache(ResponseCacheConfig{
+				TTL:                  100 * time.Millisecond,
+				StaleWhileRevalidate: time.Minute,
+				Key:                  []CacheKeyFunc{CacheKeyUser()},
+				Storage:              storage,
+			})
+
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				c.Locals("claimsData", &jwt.RegisteredClaims{Subject: c.Get("X-Sub")})
+				return c.Next()
+			})
+			app.Get("/pedidos", rc.Handler(), func(c *fiber.Ctx) error {
+				CacheTags(c, "pedidos")
+				n := calls.Add(1)
+				return c.SendString(c.Get("X-Sub") + ":" + strconv.Itoa(int(n)))
+			})
+			app.Post("/pedidos", rc.Invalidates("pedidos"), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusCreated)
+			})
+
+			request := func(method, sub string) (string, string) {
+				req := httptest.NewRequest(method, "/pedidos", nil)
+				req.Header.Set("X-Sub", sub)
+				resp, err := app.Test(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				return string(body), resp.Header.Get("X-Cache")
+			}
+
+			if body, state := request("GET", "ana"); body != "ana:1" || state != "MISS" {
+				t.Fatalf("esperava MISS ana:1, recebeu %s %s", state, body)
+			}
+			if body, state := request("GET", "ana"); body != "ana:1" || state != "HIT" {
+				t.Errorf("esperava HIT ana:1, recebeu %s %s", state, body)
+			}
+			if body, _ := request("GET", "bia"); body != "bia:2" {
+				t.Errorf("usuários não deveriam compartilhar o cache, recebeu %s", body)
+			}
+
+			request("POST", "ana")
+			if body, state := request("GET", "ana"); body != "ana:3" || state != "MISS" {
+				t.Errorf("esperava MISS após invalidar a tag, recebeu %s %s", state, body)
+			}
+
+			time.Sleep(150 * time.Millisecond)
+			if body, state := request("GET", "ana"); body != "ana:3" || state != "STALE" {
+				t.Errorf("esperava STALE ana:3, recebeu %s %s", state, body)
+			}
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				body, state := request("GET", "ana")
+				if body != "ana:3" && state == "HIT" {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("resposta não foi revalidada em segundo plano, recebeu %s %s", state, body)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	var calls atomic.Int32
+	rc := NewResponseCache(ResponseCacheConfig{TTL: time.Minute})
+	app := fiber.New()
+	app.Get("/produtos", rc.Handler(), func(c *fiber.Ctx) error {
+		c.Response().Header.Add("Link", "</a>; rel=prev")
+		c.Response().Header.Add("Link", "</b>; rel=next")
+		n := calls.Add(1)
+		return c.SendString(c.Query("pagina") + ":" + strconv.Itoa(int(n)))
+	})
+	request := func(target, auth string) (*http.Response, string) {
+		req := httptest.NewRequest("GET", target, nil)
+		if auth != "" {
+			req.Header.Set(fiber.HeaderAuthorization, auth)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	t.Run("query faz parte da chave", func(t *testing.T) {
+		request("/produtos?pagina=1&ordem=nome", "")
+		if _, body := request("/produtos?ordem=nome&pagina=1", ""); body != "1:1" {
+			t.Errorf("ordem dos parâmetros não deveria importar, recebeu %s", body)
+		}
+		if _, body := request("/produtos?pagina=2&ordem=nome", ""); body != "2:2" {
+			t.Errorf("outra página não deveria vir do cache, recebeu %s", body)
+		}
+	})
+
+	t.Run("headers repetidos são preservados", func(t *testing.T) {
+		resp, _ := request("/produtos?pagina=1&ordem=nome", "")
+		if resp.Header.Get("X-Cache") != "HIT" || len(resp.Header.Values("Link")) != 2 {
+			t.Errorf("esperava HIT com dois Link, recebeu %s %v", resp.Header.Get("X-Cache"), resp.Header.Values("Link"))
+		}
+	})
+
+	t.Run("requisição autenticada sem Key não usa o cache", func(t *testing.T) {
+		before := calls.Load()
+		for i := 0; i < 2; i++ {
+			if resp, _ := request("/produtos?pagina=3", "Bearer token"); resp.Header.Get("X-Cache") != "" {
+				t.Errorf("não deveria passar pelo cache, recebeu %s", resp.Header.Get("X-Cache"))
+			}
+		}
+		if calls.Load()-before != 2 {
+			t.Errorf("handler deveria rodar a cada requisição, rodou %d", calls.Load()-before)
+		}
+	})
+}
+
+func TestResponseCacheBeforeAuth(t *testing.T) {
+	rc := NewResponseCache(ResponseCacheConfig{TTL: time.Minute, Key: []CacheKeyFunc{CacheKeyUser()}})
+	auth := func(c *fiber.Ctx) error {
+		sub := c.Get("X-Sub")
+		if sub == "" {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		c.Locals("claimsData", &jwt.RegisteredClaims{Subject: sub})
+		return c.Next()
+	}
+	app := fiber.New()
+	app.Get("/me", rc.Handler(), auth, func(c *fiber.Ctx) error {
+		return c.SendString("segredo-de-" + c.Get("X-Sub"))
+	})
+	request := func(sub string) (int, string) {
+		req := httptest.NewRequest("GET", "/me", nil)
+		if sub != "" {
+			req.Header.Set("X-Sub", sub)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	request("ana")
+	request("ana")
+	if code, body := request("bia"); code != fiber.StatusOK || body != "segredo-de-bia" {
+		t.Errorf("bia recebeu a resposta de outro usuário: %d %s", code, body)
+	}
+	if code, body := request(""); code != fiber.StatusUnauthorized {
+		t.Errorf("requisição anônima deveria passar pela autenticação, recebeu %d %s", code, body)
+	}
+}
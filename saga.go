@@ -0,0 +1,413 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SagaRunning      = "running"
+	SagaCompensating = "compensating"
+	SagaCompleted    = "completed"
+	// SagaCompensated means a step failed and every completed step was undone.
+	SagaCompensated = "compensated"
+	// SagaFailed means a compensation kept failing and needs manual action.
+	SagaFailed = "failed"
+
+	sagaDo   = "do"
+	sagaUndo = "undo"
+)
+
+var ErrSagaNotFound = errors.New("saga not found")
+
+// SagaStep is a step of a saga. Command and Compensate are the queues its
+// command and compensating command are published to; participants answer
+// them with ConnRabbitMQ.ServeRPC, and a reply carrying an error fails the
+// step. The body of both commands is the saga data, and a JSON object
+// returned by Command is merged into it.
+type SagaStep struct {
+	Name       string
+	Command    string
+	Compensate string
+	// Timeout for the participant reply. Defaults to SagaDefinition.Timeout.
+	Timeout time.Duration
+}
+
+type SagaDefinition struct {
+	Name    string
+	Steps   []SagaStep
+	Timeout time.Duration
+	// MaxCompensations is how many times a compensating command is sent
+	// before the saga is marked SagaFailed. Defaults to 5.
+	MaxCompensations int
+	// OnFinish, when set, is called once the saga reaches a final status.
+	OnFinish func(ctx context.Context, saga *SagaInstance)
+}
+
+// SagaInstance is the persisted state of a running saga. Create the table
+// with db.AutoMigrate(&SagaInstance{}).
+type SagaInstance struct {
+	ID        string     `gorm:"size:36;primaryKey"`
+	Saga      string     `gorm:"size:255;not null;index"`
+	Status    string     `gorm:"size:16;not null;index:idx_saga_status_deadline"`
+	Step      int        `gorm:"not null"`
+	Attempts  int        `gorm:"not null;default:0"`
+	Data      []byte     `gorm:"not null"`
+	Error     string     `gorm:"type:text"`
+	Deadline  *time.Time `gorm:"index:idx_saga_status_deadline"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (SagaInstance) TableName() string {
+	return "saga_instances"
+}
+
+// Decode unmarshals the saga data into v.
+func (s *SagaInstance) Decode(v any) error {
+	return json.Unmarshal(s.Data, v)
+}
+
+// SagaOrchestrator drives sagas: it publishes step commands, consumes the
+// replies on ReplyQueue and publishes compensations when a step fails or
+// times out. State lives in the database, so any instance can pick up a saga
+// after a restart; a command lost in a crash surfaces as a step timeout.
+type SagaOrchestrator struct {
+	DB         *gorm.DB
+	Conn       *ConnRabbitMQ
+	ReplyQueue string
+	// Interval between checks for expired steps.
+	Interval time.Duration
+	Workers  int
+
+	sagas map[string]*SagaDefinition
+}
+
+func NewSagaOrchestrator(db *gorm.DB, conn *ConnRabbitMQ, replyQueue string) *SagaOrchestrator {
+	return &SagaOrchestrator{
+		DB:         db,
+		Conn:       conn,
+		ReplyQueue: replyQueue,
+		Interval:   5 * time.Second,
+		Workers:    10,
+		sagas:      make(map[string]*SagaDefinition),
+	}
+}
+
+// Register adds a saga definition. It must be called before Start and Run.
+func (o *SagaOrchestrator) Register(def SagaDefinition) error {
+	if def.Name == "" || len(def.Steps) == 0 {
+		return fmt.Errorf("saga must have a name and at least one step")
+	}
+	for i, step := range def.Steps {
+		if step.Command == "" {
+			return fmt.Errorf("saga %s: step %d has no command queue", def.Name, i)
+		}
+	}
+	if def.Timeout <= 0 {
+		def.Timeout = time.Minute
+	}
+	if def.MaxCompensations <= 0 {
+		def.MaxCompensations = 5
+	}
+	o.sagas[def.Name] = &def
+	return nil
+}
+
+// Start creates a saga with data as its initial state, sends the command of
+// its first step and returns the saga ID.
+func (o *SagaOrchestrator) Start(ctx context.Context, saga string, data any) (string, error) {
+	def, ok := o.sagas[saga]
+	if !ok {
+		return "", fmt.Errorf("saga %s is not registered", saga)
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize struct: %w", err)
+	}
+	instance := &SagaInstance{
+		ID:     uuid.NewString(),
+		Saga:   saga,
+		Status: SagaRunning,
+		Data:   payload,
+	}
+	instance.Deadline = deadline(def.stepTimeout(0))
+	if err := o.DB.WithContext(ctx).Create(instance).Error; err != nil {
+		return "", fmt.Errorf("failed to create saga: %w", err)
+	}
+	if err := o.send(ctx, def, instance); err != nil {
+		log.Printf("[Saga] Erro ao enviar comando da saga %s: %v", instance.ID, err)
+	}
+	return instance.ID, nil
+}
+
+// Get returns the current state of the saga with the given ID.
+func (o *SagaOrchestrator) Get(ctx context.Context, id string) (*SagaInstance, error) {
+	var instance SagaInstance
+	err := o.DB.WithContext(ctx).First(&instance, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSagaNotFound
+	}
+	return &instance, err
+}
+
+// Run consumes participant replies and expires overdue steps until ctx is
+// cancelled. The reply queue is declared if needed.
+func (o *SagaOrchestrator) Run(ctx context.Context) error {
+	if _, err := o.Conn.Channel.QueueDeclare(o.ReplyQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("falha ao declarar fila %s: %w", o.ReplyQueue, err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(o.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := o.expire(ctx); err != nil {
+				log.Printf("[Saga] Erro ao verificar passos expirados: %v", err)
+			}
+		}
+	}()
+
+	return o.Conn.Consumer(ctx, o.Workers, o.ReplyQueue, "saga-orchestrator", func(d amqp.Delivery) error {
+		id, step, phase, ok := parseSagaCorrelation(d.CorrelationId)
+		if !ok {
+			log.Printf("[Saga] Resposta com correlation id inválido descartada: %q", d.CorrelationId)
+			return nil
+		}
+		var failure error
+		if msg, ok := d.Headers[headerRPCError].(string); ok {
+			failure = errors.New(msg)
+		}
+		return o.advance(ctx, id, func(def *SagaDefinition, instance *SagaInstance) bool {
+			if instance.Step != step || instance.phase() != phase {
+				return false
+			}
+			if failure != nil {
+				o.fail(def, instance, failure, false)
+				return true
+			}
+			o.succeed(def, instance, d.Body)
+			return true
+		})
+	})
+}
+
+// expire fails the steps whose deadline has passed.
+func (o *SagaOrchestrator) expire(ctx context.Context) error {
+	var ids []string
+	err := o.DB.WithContext(ctx).Model(&SagaInstance{}).
+		Where("status IN ? AND deadline <= ?", []string{SagaRunning, SagaCompensating}, time.Now()).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err := o.advance(ctx, id, func(def *SagaDefinition, instance *SagaInstance) bool {
+			if instance.Deadline == nil || instance.Deadline.After(time.Now()) {
+				return false
+			}
+			o.fail(def, instance, fmt.Errorf("step %s timed out", def.Steps[instance.Step].Name), true)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advance loads the saga with a row lock, applies change and, when it
+// reports a transition, saves the saga and sends its next command.
+func (o *SagaOrchestrator) advance(ctx context.Context, id string, change func(*SagaDefinition, *SagaInstance) bool) error {
+	var instance SagaInstance
+	var def *SagaDefinition
+	changed := false
+	err := o.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx
+		if tx.Dialector.Name() == "postgres" || tx.Dialector.Name() == "mysql" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		if err := query.First(&instance, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		var ok bool
+		if def, ok = o.sagas[instance.Saga]; !ok {
+			return fmt.Errorf("saga %s is not registered", instance.Saga)
+		}
+		if !instance.active() || !change(def, &instance) {
+			return nil
+		}
+		changed = true
+		return tx.Save(&instance).Error
+	})
+	if err != nil || !changed {
+		return err
+	}
+
+	if !instance.active() {
+		log.Printf("[Saga] Saga %s (%s) finalizada com status %s", instance.ID, instance.Saga, instance.Status)
+		if def.OnFinish != nil {
+			def.OnFinish(ctx, &instance)
+		}
+		return nil
+	}
+	if err := o.send(ctx, def, &instance); err != nil {
+		// The step deadline is already set, so the timeout check retries or
+		// compensates it.
+		log.Printf("[Saga] Erro ao enviar comando da saga %s: %v", instance.ID, err)
+	}
+	return nil
+}
+
+// succeed records a successful reply and moves to the next step.
+func (o *SagaOrchestrator) succeed(def *SagaDefinition, instance *SagaInstance, reply []byte) {
+	if instance.Status == SagaCompensating {
+		o.compensateFrom(def, instance, instance.Step-1)
+		return
+	}
+	instance.Data = mergeSagaData(instance.Data, reply)
+	instance.Step++
+	if instance.Step == len(def.Steps) {
+		instance.Status = SagaCompleted
+		instance.Deadline = nil
+		return
+	}
+	instance.Deadline = deadline(def.stepTimeout(instance.Step))
+}
+
+// fail handles a failed or expired step: a forward step starts compensation
+// and a compensation is retried until MaxCompensations. A step that timed out
+// may have been applied by its participant, so it is compensated as well.
+func (o *SagaOrchestrator) fail(def *SagaDefinition, instance *SagaInstance, err error, timedOut bool) {
+	if instance.Status == SagaCompensating {
+		instance.Attempts++
+		if instance.Attempts >= def.MaxCompensations {
+			instance.Status = SagaFailed
+			instance.Error = fmt.Sprintf("%s; compensation of step %s failed: %v", instance.Error, def.Steps[instance.Step].Name, err)
+			instance.Deadline = nil
+			return
+		}
+		instance.Deadline = deadline(def.stepTimeout(instance.Step))
+		return
+	}
+	instance.Status = SagaCompensating
+	instance.Error = fmt.Sprintf("step %s failed: %v", def.Steps[instance.Step].Name, err)
+	from := instance.Step - 1
+	if timedOut {
+		from = instance.Step
+	}
+	o.compensateFrom(def, instance, from)
+}
+
+// compensateFrom moves to the last step at or before step that has a
+// compensating command, or finishes the saga when there is none.
+func (o *SagaOrchestrator) compensateFrom(def *SagaDefinition, instance *SagaInstance, step int) {
+	for step >= 0 && def.Steps[step].Compensate == "" {
+		step--
+	}
+	instance.Attempts = 0
+	if step < 0 {
+		instance.Status = SagaCompensated
+		instance.Deadline = nil
+		return
+	}
+	instance.Step = step
+	instance.Deadline = deadline(def.stepTimeout(step))
+}
+
+// send publishes the command of the current step, or its compensation.
+func (o *SagaOrchestrator) send(ctx context.Context, def *SagaDefinition, instance *SagaInstance) error {
+	step := def.Steps[instance.Step]
+	queue := step.Command
+	if instance.Status == SagaCompensating {
+		queue = step.Compensate
+	}
+	return o.Conn.Channel.PublishWithContext(ctx, "", queue, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: sagaCorrelation(instance.ID, instance.Step, instance.phase()),
+		ReplyTo:       o.ReplyQueue,
+		Headers:       amqp.Table{"x-saga": instance.Saga, "x-saga-step": step.Name},
+		Body:          instance.Data,
+		Timestamp:     time.Now(),
+	})
+}
+
+func (s *SagaInstance) active() bool {
+	return s.Status == SagaRunning || s.Status == SagaCompensating
+}
+
+func (s *SagaInstance) phase() string {
+	if s.Status == SagaCompensating {
+		return sagaUndo
+	}
+	return sagaDo
+}
+
+func (d *SagaDefinition) stepTimeout(step int) time.Duration {
+	if t := d.Steps[step].Timeout; t > 0 {
+		return t
+	}
+	return d.Timeout
+}
+
+func deadline(timeout time.Duration) *time.Time {
+	t := time.Now().Add(timeout)
+	return &t
+}
+
+func sagaCorrelation(id string, step int, phase string) string {
+	return id + ":" + strconv.Itoa(step) + ":" + phase
+}
+
+func parseSagaCorrelation(correlation string) (id string, step int, phase string, ok bool) {
+	parts := strings.Split(correlation, ":")
+	if len(parts) != 3 {
+		return "", 0, "", false
+	}
+	step, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, "", false
+	}
+	return parts[0], step, parts[2], true
+}
+
+// mergeSagaData merges the keys of reply into data when both are JSON objects
+// and returns data unchanged otherwise.
+func mergeSagaData(data, reply []byte) []byte {
+	var patch map[string]json.RawMessage
+	if len(reply) == 0 || json.Unmarshal(reply, &patch) != nil || len(patch) == 0 {
+		return data
+	}
+	var state map[string]json.RawMessage
+	if json.Unmarshal(data, &state) != nil || state == nil {
+		return data
+	}
+	for k, v := range patch {
+		state[k] = v
+	}
+	merged, err := json.Marshal(state)
+	if err != nil {
+		return data
+	}
+	return merged
+}
@@ -0,0 +1,72 @@
+package gorote
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSagaTransitions(t *testing.T) {
+	o := NewSagaOrchestrator(nil, nil, "saga.replies")
+	err := o.Register(SagaDefinition{
+		Name: "pedido",
+		Steps: []SagaStep{
+			{Name: "reservar", Command: "estoque.reservar", Compensate: "estoque.liberar"},
+			{Name: "notificar", Command: "email.enviar"},
+			{Name: "cobrar", Command: "pagamento.cobrar", Compensate: "pagamento.estornar"},
+			{Name: "enviar", Command: "envio.criar"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := o.sagas["pedido"]
+
+	t.Run("sucesso mescla a resposta e conclui", func(t *testing.T) {
+		instance := &SagaInstance{Status: SagaRunning, Data: []byte(`{"pedido":1}`)}
+		for i := range def.Steps {
+			o.succeed(def, instance, []byte(`{"passo`+def.Steps[i].Name+`":true}`))
+		}
+		if instance.Status != SagaCompleted || instance.Deadline != nil {
+			t.Errorf("esperava saga concluída, recebeu %s", instance.Status)
+		}
+		var data map[string]any
+		instance.Decode(&data)
+		if data["pedido"] != float64(1) || data["passoenviar"] != true {
+			t.Errorf("dados não mesclados: %v", data)
+		}
+	})
+
+	t.Run("falha compensa passos anteriores pulando os sem compensação", func(t *testing.T) {
+		instance := &SagaInstance{Status: SagaRunning, Step: 3, Data: []byte(`{}`)}
+		o.fail(def, instance, errors.New("sem estoque"), false)
+		if instance.Status != SagaCompensating || instance.Step != 2 {
+			t.Fatalf("esperava compensar o passo 2, recebeu %s/%d", instance.Status, instance.Step)
+		}
+		o.succeed(def, instance, nil)
+		if instance.Status != SagaCompensating || instance.Step != 0 {
+			t.Fatalf("esperava compensar o passo 0, recebeu %s/%d", instance.Status, instance.Step)
+		}
+		o.succeed(def, instance, nil)
+		if instance.Status != SagaCompensated {
+			t.Errorf("esperava saga compensada, recebeu %s", instance.Status)
+		}
+	})
+
+	t.Run("timeout compensa o próprio passo", func(t *testing.T) {
+		instance := &SagaInstance{Status: SagaRunning, Step: 2, Data: []byte(`{}`)}
+		o.fail(def, instance, errors.New("timeout"), true)
+		if instance.Step != 2 || instance.phase() != sagaUndo {
+			t.Errorf("esperava compensar o passo 2, recebeu %s/%d", instance.Status, instance.Step)
+		}
+	})
+
+	t.Run("compensação falhando esgota tentativas", func(t *testing.T) {
+		instance := &SagaInstance{Status: SagaCompensating, Step: 0, Data: []byte(`{}`)}
+		for i := 0; i < def.MaxCompensations; i++ {
+			o.fail(def, instance, errors.New("indisponível"), false)
+		}
+		if instance.Status != SagaFailed {
+			t.Errorf("esperava saga com falha, recebeu %s", instance.Status)
+		}
+	})
+}
@@ -2,102 +2,324 @@ package gorote
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
+// InitSQS configures the SQS client. AccessKeyID and SecretAccessKey are
+// optional: when empty the default AWS credential chain is used (environment,
+// shared config, instance or task role). RoleARN assumes that role on top of
+// the base credentials and Endpoint points the client at a local stand-in such
+// as ElasticMQ, LocalStack or sqstest.
 type InitSQS struct {
 	Region          string
 	AccessKeyID     string
 	SecretAccessKey string
 	SessionToken    string
+	Endpoint        string
+	RoleARN         string
+	ExternalID      string
+	RoleSessionName string
 }
 
 type ConnSQS struct {
 	*sqs.Client
+	Metrics   *ConsumerMetrics
+	Heartbeat *HeartbeatSQS
+	Offload   *OffloadSQS
 }
 
 type HandlesSQS func(context.Context, types.Message) error
 
 func (s *InitSQS) Connect(ctx context.Context) (*ConnSQS, error) {
-	if s.Region == "" || s.AccessKeyID == "" || s.SecretAccessKey == "" {
+	if s.Region == "" {
+		return nil, fmt.Errorf("região inválida")
+	}
+	if (s.AccessKeyID == "") != (s.SecretAccessKey == "") {
 		return nil, fmt.Errorf("credenciais inválidas")
 	}
-	customConfig, err := config.LoadDefaultConfig(
-		ctx,
-		config.WithRegion(s.Region),
-		config.WithCredentialsProvider(credentials.StaticCredentialsProvider{
+
+	opts := []func(*config.LoadOptions) error{config.WithRegion(s.Region)}
+	if s.AccessKeyID != "" {
+		opts = append(opts, config.WithCredentialsProvider(credentials.StaticCredentialsProvider{
 			Value: aws.Credentials{
 				AccessKeyID:     s.AccessKeyID,
 				SecretAccessKey: s.SecretAccessKey,
 				SessionToken:    s.SessionToken,
 			},
-		}),
-	)
+		}))
+	}
+	customConfig, err := config.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &ConnSQS{sqs.NewFromConfig(customConfig)}, nil
+
+	if s.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(customConfig), s.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			if s.ExternalID != "" {
+				o.ExternalID = aws.String(s.ExternalID)
+			}
+			if s.RoleSessionName != "" {
+				o.RoleSessionName = s.RoleSessionName
+			}
+		})
+		customConfig.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	client := sqs.NewFromConfig(customConfig, func(o *sqs.Options) {
+		if s.Endpoint != "" {
+			o.BaseEndpoint = aws.String(s.Endpoint)
+		}
+	})
+	return &ConnSQS{Client: client}, nil
+}
+
+// ConsumerOptionsSQS configures ConnSQS.ConsumerMessages.
+type ConsumerOptionsSQS struct {
+	QueueURL string
+	// Workers is the number of messages handled concurrently. Defaults to 10.
+	Workers int
+	// Pollers is the number of concurrent ReceiveMessage loops. Defaults to 1.
+	Pollers int
+	// MaxMessages per ReceiveMessage call, from 1 to 10. Defaults to 10.
+	MaxMessages int32
+	// WaitTime for long polling, up to 20s. Defaults to 20s.
+	WaitTime time.Duration
+	// VisibilityTimeout overrides the queue default when set.
+	VisibilityTimeout     time.Duration
+	AttributeNames        []types.MessageSystemAttributeName
+	MessageAttributeNames []string
+	// RetryBackoff and MaxRetryBackoff bound the exponential wait between
+	// failed ReceiveMessage calls. Default to 1s and 30s.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// ErrorHandlers run in order when the handler or the delete fails, until
+	// one of them returns an error.
+	ErrorHandlers []HandlesSQS
+	// DeleteBatchSize above 1 buffers deletions into DeleteMessageBatch calls
+	// of up to this many messages, flushed at least every DeleteInterval
+	// (default 1s) and on shutdown.
+	DeleteBatchSize int
+	DeleteInterval  time.Duration
 }
 
-func (s ConnSQS) ConsumerMessages(ctx context.Context, worker int, queueURL string, handler HandlesSQS, errHandlers ...HandlesSQS) error {
-	if worker > 10 || worker <= 0 {
-		return fmt.Errorf("quantidade de workers inválida min: 1, max: 10")
+func (o ConsumerOptionsSQS) withDefaults() (ConsumerOptionsSQS, error) {
+	if o.QueueURL == "" {
+		return o, fmt.Errorf("queue url is required")
 	}
-	sem := make(chan struct{}, worker)
-	var wg sync.WaitGroup
-	for {
-		resp, err := s.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-			QueueUrl:            &queueURL,
-			MaxNumberOfMessages: 10,
-			WaitTimeSeconds:     5,
+	if o.Workers <= 0 {
+		o.Workers = 10
+	}
+	if o.Pollers <= 0 {
+		o.Pollers = 1
+	}
+	if o.MaxMessages == 0 {
+		o.MaxMessages = 10
+	}
+	if o.MaxMessages < 1 || o.MaxMessages > 10 {
+		return o, fmt.Errorf("quantidade de mensagens inválida min: 1, max: 10")
+	}
+	if o.WaitTime == 0 {
+		o.WaitTime = 20 * time.Second
+	}
+	if o.WaitTime < 0 || o.WaitTime > 20*time.Second {
+		return o, fmt.Errorf("tempo de espera inválido min: 0s, max: 20s")
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = time.Second
+	}
+	if o.MaxRetryBackoff < o.RetryBackoff {
+		o.MaxRetryBackoff = 30 * time.Second
+	}
+	return o, nil
+}
+
+func (s ConnSQS) ConsumerMessages(ctx context.Context, opts ConsumerOptionsSQS, handler HandlesSQS) error {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return err
+	}
+	handle, stop := s.messageHandler(ctx, opts, handler)
+	defer stop()
+	return s.receive(ctx, opts, func(ctx context.Context, m types.Message) {
+		handle(ctx, m)
+	})
+}
+
+// messageHandler runs handler for a received message, deletes it on success
+// and calls opts.ErrorHandlers on failure. stop must be called once no more
+// messages will be handled, to flush buffered deletions. handle returns the
+// error of the handler, after the error handlers ran.
+func (s ConnSQS) messageHandler(ctx context.Context, opts ConsumerOptionsSQS, handler HandlesSQS) (handle func(context.Context, types.Message) error, stop func()) {
+	queueURL := opts.QueueURL
+	if s.Heartbeat != nil {
+		heartbeat := *s.Heartbeat
+		if heartbeat.VisibilityTimeout <= 0 {
+			heartbeat.VisibilityTimeout = opts.VisibilityTimeout
+		}
+		handler = s.VisibilityHeartbeat(queueURL, heartbeat)(handler)
+	}
+	onError := func(ctx context.Context, m types.Message) {
+		for _, errHandler := range opts.ErrorHandlers {
+			if err := errHandler(ctx, m); err != nil {
+				return
+			}
+		}
+	}
+
+	remove := func(ctx context.Context, m types.Message) {
+		_, err := s.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      &queueURL,
+			ReceiptHandle: m.ReceiptHandle,
 		})
+		s.Metrics.ack(queueURL, err)
+		if err != nil {
+			onError(ctx, m)
+			return
+		}
+		s.Offload.cleanup(ctx, m)
+	}
+	stop = func() {}
+	if opts.DeleteBatchSize > 1 {
+		buffer := s.NewAckBuffer(queueURL, opts.DeleteBatchSize, opts.DeleteInterval)
+		buffer.OnError = func(ctx context.Context, m types.Message, err error) {
+			log.Printf("[SQS] Falha ao remover mensagem %s: %v", aws.ToString(m.MessageId), err)
+			onError(ctx, m)
+		}
+		buffer.OnDeleted = s.Offload.cleanup
+		bufferCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		finished := make(chan struct{})
+		go func() {
+			buffer.Run(bufferCtx)
+			close(finished)
+		}()
+		remove = func(ctx context.Context, m types.Message) {
+			buffer.Ack(m)
+		}
+		stop = func() {
+			cancel()
+			<-finished
+		}
+	}
+
+	handle = func(ctx context.Context, m types.Message) error {
+		done := s.Metrics.start(queueURL)
+		resolved, err := s.Offload.resolve(ctx, m)
+		if err == nil {
+			err = handler(ctx, resolved)
+		}
+		done(err)
 		if err != nil {
-			time.Sleep(2 * time.Second)
+			onError(ctx, m)
 			return err
 		}
+		remove(ctx, m)
+		return nil
+	}
+	return handle, stop
+}
 
-		for _, msg := range resp.Messages {
+// receive runs opts.Pollers receive loops and hands each message to handle on
+// up to opts.Workers goroutines. handle is responsible for deleting the
+// message. opts must already have its defaults applied.
+func (s ConnSQS) receive(ctx context.Context, opts ConsumerOptionsSQS, handle func(context.Context, types.Message)) error {
+	sem := make(chan struct{}, opts.Workers)
+	var wg sync.WaitGroup
+	err := s.runPollers(ctx, opts, func(batch []types.Message) bool {
+		for _, m := range batch {
 			select {
 			case <-ctx.Done():
-				wg.Wait()
-				return fmt.Errorf("contexto encerrado. Finalizando leitura da fila")
+				return false
 			case sem <- struct{}{}:
 				wg.Add(1)
-				go func(m types.Message) {
+				go func() {
 					defer func() {
 						<-sem
 						wg.Done()
 					}()
-					if err := handler(ctx, m); err != nil {
-						for _, errHandler := range errHandlers {
-							if err := errHandler(ctx, msg); err != nil {
-								return
-							}
-						}
-						return
-					}
-					_, err := s.DeleteMessage(ctx, &sqs.DeleteMessageInput{
-						QueueUrl:      &queueURL,
-						ReceiptHandle: m.ReceiptHandle,
-					})
-					if err != nil {
-						for _, errHandler := range errHandlers {
-							if err := errHandler(ctx, msg); err != nil {
-								return
-							}
-						}
-						return
-					}
-				}(msg)
+					handle(ctx, m)
+				}()
 			}
 		}
+		return true
+	})
+	wg.Wait()
+	return err
+}
+
+// runPollers runs opts.Pollers receive loops passing every received batch to
+// dispatch, which returns false when the consumer is shutting down. The first
+// poller to stop, e.g. because the queue does not exist, stops the others and
+// its error is returned.
+func (s ConnSQS) runPollers(ctx context.Context, opts ConsumerOptionsSQS, dispatch func([]types.Message) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:                    aws.String(opts.QueueURL),
+		MaxNumberOfMessages:         opts.MaxMessages,
+		WaitTimeSeconds:             int32(opts.WaitTime / time.Second),
+		VisibilityTimeout:           int32(opts.VisibilityTimeout / time.Second),
+		MessageSystemAttributeNames: opts.AttributeNames,
+		MessageAttributeNames:       opts.MessageAttributeNames,
+	}
+
+	errs := make(chan error, opts.Pollers)
+	for i := 0; i < opts.Pollers; i++ {
+		go func() {
+			errs <- s.poll(ctx, opts, input, dispatch)
+		}()
+	}
+
+	err := <-errs
+	cancel()
+	for i := 1; i < opts.Pollers; i++ {
+		<-errs
+	}
+	return err
+}
+
+func (s ConnSQS) poll(ctx context.Context, opts ConsumerOptionsSQS, input *sqs.ReceiveMessageInput, dispatch func([]types.Message) bool) error {
+	failures := 0
+	for {
+		if ctx.Err() != nil {
+			return fmt.Errorf("contexto encerrado. Finalizando leitura da fila")
+		}
+
+		resp, err := s.ReceiveMessage(ctx, input)
+		s.Metrics.poll(err)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("contexto encerrado. Finalizando leitura da fila")
+			}
+			var notFound *types.QueueDoesNotExist
+			if errors.As(err, &notFound) {
+				return err
+			}
+			delay := backoffDelay(failures, opts.RetryBackoff, opts.MaxRetryBackoff)
+			failures++
+			log.Printf("[SQS] Erro ao receber mensagens: %v - nova tentativa em %s", err, delay)
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+			continue
+		}
+		failures = 0
+
+		if len(resp.Messages) > 0 && !dispatch(resp.Messages) {
+			return fmt.Errorf("contexto encerrado. Finalizando leitura da fila")
+		}
 	}
 }
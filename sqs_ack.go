@@ -0,0 +1,193 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const maxAckAttemptsSQS = 3
+
+type pendingAckSQS struct {
+	msg      types.Message
+	attempts int
+}
+
+// AckBufferSQS groups message deletions into DeleteMessageBatch calls, flushed
+// when Size messages are pending or every Interval. Entries SQS fails on its
+// side are retried on the next flush; the others are reported to OnError.
+type AckBufferSQS struct {
+	Conn     ConnSQS
+	QueueURL string
+	Size     int
+	Interval time.Duration
+	OnError  func(ctx context.Context, m types.Message, err error)
+	// OnDeleted, when set, is called for every message deleted successfully.
+	OnDeleted func(ctx context.Context, m types.Message)
+
+	mu      sync.Mutex
+	pending []pendingAckSQS
+	kick    chan struct{}
+}
+
+func (s ConnSQS) NewAckBuffer(queueURL string, size int, interval time.Duration) *AckBufferSQS {
+	if size <= 0 || size > maxBatchSQS {
+		size = maxBatchSQS
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &AckBufferSQS{
+		Conn:     s,
+		QueueURL: queueURL,
+		Size:     size,
+		Interval: interval,
+		kick:     make(chan struct{}, 1),
+	}
+}
+
+// Ack queues m for deletion.
+func (a *AckBufferSQS) Ack(m types.Message) {
+	a.mu.Lock()
+	a.pending = append(a.pending, pendingAckSQS{msg: m})
+	full := len(a.pending) >= a.Size
+	a.mu.Unlock()
+	if full {
+		select {
+		case a.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run flushes the buffer until ctx is cancelled, then flushes what is left.
+// Messages the final flush could not delete are reported to OnError, since
+// they will be received again once their visibility timeout expires.
+func (a *AckBufferSQS) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			a.close(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+		case <-a.kick:
+		}
+		if err := a.Flush(ctx); err != nil {
+			log.Printf("[SQS] Erro ao remover mensagens em lote: %v", err)
+		}
+	}
+}
+
+// Flush deletes every pending message.
+func (a *AckBufferSQS) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+
+	var retry []pendingAckSQS
+	var firstErr error
+	for start := 0; start < len(pending); start += maxBatchSQS {
+		chunk := pending[start:min(start+maxBatchSQS, len(pending))]
+		failed, err := a.deleteBatch(ctx, chunk)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		retry = append(retry, failed...)
+	}
+
+	if len(retry) > 0 {
+		a.mu.Lock()
+		a.pending = append(retry, a.pending...)
+		a.mu.Unlock()
+	}
+	return firstErr
+}
+
+func (a *AckBufferSQS) close(ctx context.Context) {
+	err := a.Flush(ctx)
+	a.mu.Lock()
+	left := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+	if err == nil {
+		err = errors.New("ack buffer stopped before the message was deleted")
+	}
+	for _, p := range left {
+		a.fail(ctx, p.msg, err)
+	}
+}
+
+// deleteBatch deletes chunk and returns the entries that should be retried.
+func (a *AckBufferSQS) deleteBatch(ctx context.Context, chunk []pendingAckSQS) ([]pendingAckSQS, error) {
+	entries := make([]types.DeleteMessageBatchRequestEntry, len(chunk))
+	for i, p := range chunk {
+		entries[i] = types.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: p.msg.ReceiptHandle,
+		}
+	}
+
+	out, err := a.Conn.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(a.QueueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		var retry []pendingAckSQS
+		for _, p := range chunk {
+			if p, ok := a.retryable(ctx, p, err); ok {
+				retry = append(retry, p)
+			}
+		}
+		return retry, err
+	}
+
+	for _, ok := range out.Successful {
+		a.Conn.Metrics.ack(a.QueueURL, nil)
+		if a.OnDeleted != nil {
+			index, _ := strconv.Atoi(aws.ToString(ok.Id))
+			a.OnDeleted(ctx, chunk[index].msg)
+		}
+	}
+	var retry []pendingAckSQS
+	for _, failed := range out.Failed {
+		index, _ := strconv.Atoi(aws.ToString(failed.Id))
+		failErr := fmt.Errorf("%s: %s", aws.ToString(failed.Code), aws.ToString(failed.Message))
+		if failed.SenderFault {
+			a.fail(ctx, chunk[index].msg, failErr)
+			continue
+		}
+		if p, ok := a.retryable(ctx, chunk[index], failErr); ok {
+			retry = append(retry, p)
+		}
+	}
+	return retry, nil
+}
+
+func (a *AckBufferSQS) retryable(ctx context.Context, p pendingAckSQS, err error) (pendingAckSQS, bool) {
+	p.attempts++
+	if p.attempts >= maxAckAttemptsSQS {
+		a.fail(ctx, p.msg, err)
+		return p, false
+	}
+	return p, true
+}
+
+func (a *AckBufferSQS) fail(ctx context.Context, m types.Message, err error) {
+	a.Conn.Metrics.ack(a.QueueURL, err)
+	if a.OnError != nil {
+		a.OnError(ctx, m, err)
+		return
+	}
+	log.Printf("[SQS] Falha ao remover mensagem %s: %v", aws.ToString(m.MessageId), err)
+}
@@ -0,0 +1,131 @@
+package gorote
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+func TestAckBufferSQS(t *testing.T) {
+	conn, srv := newTestSQS(t)
+	ctx := context.Background()
+	setup := func(t *testing.T, queue string, n int) (*AckBufferSQS, []types.Message, func() []error) {
+		t.Helper()
+		queueURL := srv.CreateQueue(queue, nil)
+		for i := 0; i < n; i++ {
+			if _, err := conn.Send(ctx, queueURL, MessageSQS{Body: "{}"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		out, err := conn.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL), MaxNumberOfMessages: int32(n)})
+		if err != nil || len(out.Messages) != n {
+			t.Fatalf("esperava %d mensagens, recebeu %d %v", n, len(out.Messages), err)
+		}
+
+		var mu sync.Mutex
+		var errs []error
+		a := conn.NewAckBuffer(queueURL, 10, time.Hour)
+		a.OnError = func(_ context.Context, _ types.Message, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}
+		return a, out.Messages, func() []error {
+			mu.Lock()
+			defer mu.Unlock()
+			return errs
+		}
+	}
+
+	t.Run("falha parcial reporta só a mensagem inválida", func(t *testing.T) {
+		a, messages, errs := setup(t, "parcial", 2)
+		deleted := 0
+		a.OnDeleted = func(context.Context, types.Message) { deleted++ }
+		messages[1].ReceiptHandle = aws.String("invalido")
+		a.Ack(messages[0])
+		a.Ack(messages[1])
+		if err := a.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if deleted != 1 || len(errs()) != 1 {
+			t.Errorf("esperava 1 removida e 1 erro, recebeu %d e %v", deleted, errs())
+		}
+		if len(a.pending) != 0 {
+			t.Errorf("falha do remetente não deveria ser repetida, restam %d", len(a.pending))
+		}
+		if n := srv.Len("parcial"); n != 1 {
+			t.Errorf("esperava 1 mensagem na fila, restam %d", n)
+		}
+	})
+
+	t.Run("repete até o limite de tentativas", func(t *testing.T) {
+		a, messages, errs := setup(t, "tentativas", 1)
+		a.Ack(messages[0])
+		srv.FailNext("DeleteMessageBatch", "InternalError", -1)
+		defer srv.FailNext("DeleteMessageBatch", "", 0)
+		for i := 1; i < maxAckAttemptsSQS; i++ {
+			if err := a.Flush(ctx); err == nil {
+				t.Fatalf("tentativa %d deveria falhar", i)
+			}
+			if len(a.pending) != 1 || len(errs()) != 0 {
+				t.Fatalf("tentativa %d deveria manter a mensagem pendente", i)
+			}
+		}
+		a.Flush(ctx)
+		if len(a.pending) != 0 || len(errs()) != 1 {
+			t.Errorf("esperava desistir após %d tentativas, pendentes %d, erros %v", maxAckAttemptsSQS, len(a.pending), errs())
+		}
+	})
+
+	t.Run("falha temporária é repetida no próximo flush", func(t *testing.T) {
+		a, messages, errs := setup(t, "temporaria", 1)
+		a.Ack(messages[0])
+		srv.FailNext("DeleteMessageBatch", "InternalError", 1)
+		if err := a.Flush(ctx); err == nil {
+			t.Fatal("primeira tentativa deveria falhar")
+		}
+		if err := a.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if n := srv.Len("temporaria"); n != 0 || len(errs()) != 0 {
+			t.Errorf("mensagem deveria ter sido removida, restam %d, erros %v", n, errs())
+		}
+	})
+
+	t.Run("parada remove o que está pendente", func(t *testing.T) {
+		a, messages, errs := setup(t, "parada", 3)
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			a.Run(runCtx)
+			close(done)
+		}()
+		for _, m := range messages {
+			a.Ack(m)
+		}
+		cancel()
+		<-done
+		if n := srv.Len("parada"); n != 0 || len(errs()) != 0 {
+			t.Errorf("esperava a fila vazia, restam %d, erros %v", n, errs())
+		}
+	})
+
+	t.Run("parada reporta o que não foi removido", func(t *testing.T) {
+		a, messages, errs := setup(t, "parada-falha", 2)
+		for _, m := range messages {
+			a.Ack(m)
+		}
+		srv.FailNext("DeleteMessageBatch", "InternalError", 1)
+		runCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		a.Run(runCtx)
+		if len(a.pending) != 0 || len(errs()) != 2 {
+			t.Errorf("esperava 2 erros reportados, pendentes %d, erros %v", len(a.pending), errs())
+		}
+	})
+}
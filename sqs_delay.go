@@ -0,0 +1,160 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// MaxDelaySQS is the longest delay SQS accepts through DelaySeconds.
+const MaxDelaySQS = 15 * time.Minute
+
+// ErrDelayFIFO is returned when delaying a message to a FIFO queue, which
+// only supports a delay set on the queue itself.
+var ErrDelayFIFO = errors.New("per-message delay is not supported on FIFO queues")
+
+// SendDelayed sends data to queueURL with the given delivery delay. SQS only
+// supports delays up to MaxDelaySQS; use SchedulerSQS for longer ones. FIFO
+// queues are rejected with ErrDelayFIFO.
+func (s ConnSQS) SendDelayed(ctx context.Context, queueURL string, data any, delay time.Duration) error {
+	if IsFIFOQueue(queueURL) {
+		return ErrDelayFIFO
+	}
+	if delay > MaxDelaySQS {
+		return fmt.Errorf("delay %s exceeds SQS maximum of %s", delay, MaxDelaySQS)
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize struct: %w", err)
+	}
+	return s.sendDelayedBody(ctx, queueURL, string(body), delay)
+}
+
+func (s ConnSQS) sendDelayedBody(ctx context.Context, queueURL, body string, delay time.Duration) error {
+	if delay < 0 {
+		delay = 0
+	}
+	_, err := s.Send(ctx, queueURL, MessageSQS{Body: body, Delay: delay})
+	return err
+}
+
+type scheduledSQS struct {
+	ID       string `json:"id"`
+	QueueURL string `json:"queue_url"`
+	Body     string `json:"body"`
+}
+
+// SchedulerSQS publishes messages with arbitrary delays. Delays within
+// MaxDelaySQS go straight to SQS; longer ones are kept in a Redis sorted set
+// scored by due time and forwarded by Run once they are close enough.
+type SchedulerSQS struct {
+	Conn     *ConnSQS
+	Redis    *redis.Client
+	Key      string
+	Interval time.Duration
+	Batch    int64
+}
+
+func NewSchedulerSQS(conn *ConnSQS, client *redis.Client) *SchedulerSQS {
+	return &SchedulerSQS{
+		Conn:     conn,
+		Redis:    client,
+		Key:      "gorote:sqs:scheduled",
+		Interval: 5 * time.Second,
+		Batch:    100,
+	}
+}
+
+func (s *SchedulerSQS) Publish(ctx context.Context, queueURL string, data any, delay time.Duration) error {
+	if IsFIFOQueue(queueURL) {
+		return ErrDelayFIFO
+	}
+	if delay <= MaxDelaySQS {
+		return s.Conn.SendDelayed(ctx, queueURL, data, delay)
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize struct: %w", err)
+	}
+	member, err := json.Marshal(scheduledSQS{ID: uuid.NewString(), QueueURL: queueURL, Body: string(body)})
+	if err != nil {
+		return fmt.Errorf("failed to serialize scheduled message: %w", err)
+	}
+	due := time.Now().Add(delay)
+	if err := s.Redis.ZAdd(ctx, s.Key, &redis.Z{Score: float64(due.UnixMilli()), Member: member}).Err(); err != nil {
+		return fmt.Errorf("failed to schedule message: %w", err)
+	}
+	return nil
+}
+
+func (s *SchedulerSQS) PublishAt(ctx context.Context, queueURL string, data any, at time.Time) error {
+	return s.Publish(ctx, queueURL, data, time.Until(at))
+}
+
+// Run forwards scheduled messages to SQS until ctx is cancelled. Messages are
+// picked up when they are within MaxDelaySQS of their due time and sent with
+// the remaining delay. Several instances can run concurrently: a message is
+// only forwarded by the instance that removes it from the set.
+func (s *SchedulerSQS) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		if err := s.forward(ctx); err != nil {
+			log.Printf("[SQS] Erro ao encaminhar mensagens agendadas: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *SchedulerSQS) forward(ctx context.Context) error {
+	horizon := time.Now().Add(MaxDelaySQS - s.Interval)
+	members, err := s.Redis.ZRangeByScoreWithScores(ctx, s.Key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(horizon.UnixMilli(), 10),
+		Count: s.Batch,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, z := range members {
+		member, _ := z.Member.(string)
+		removed, err := s.Redis.ZRem(ctx, s.Key, member).Result()
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			continue
+		}
+
+		var msg scheduledSQS
+		if err := json.Unmarshal([]byte(member), &msg); err != nil {
+			log.Printf("[SQS] Mensagem agendada inválida descartada: %v", err)
+			continue
+		}
+
+		due := time.UnixMilli(int64(z.Score))
+		if err := s.Conn.sendDelayedBody(ctx, msg.QueueURL, msg.Body, time.Until(due)); err != nil {
+			// The message is already out of the set, so put it back even when
+			// ctx was cancelled during the send.
+			zerr := s.Redis.ZAdd(context.WithoutCancel(ctx), s.Key, &redis.Z{Score: z.Score, Member: member}).Err()
+			if zerr != nil {
+				log.Printf("[SQS] Mensagem agendada %s perdida ao reagendar: %s", msg.ID, member)
+				return errors.Join(err, fmt.Errorf("failed to reschedule message %s: %w", msg.ID, zerr))
+			}
+			return err
+		}
+	}
+	return nil
+}
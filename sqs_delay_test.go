@@ -0,0 +1,86 @@
+package gorote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDelaySeconds(t *testing.T) {
+	cases := map[time.Duration]int32{0: 0, time.Nanosecond: 1, time.Second: 1, 1500 * time.Millisecond: 2, MaxDelaySQS: 900}
+	for delay, want := range cases {
+		if got := delaySeconds(delay); got != want {
+			t.Errorf("delaySeconds(%s) = %d, esperava %d", delay, got, want)
+		}
+	}
+}
+
+// failingCommand makes every call of the named Redis command fail.
+type failingCommand string
+
+func (f failingCommand) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if cmd.Name() == string(f) {
+		return ctx, errors.New("indisponível")
+	}
+	return ctx, nil
+}
+
+func (failingCommand) AfterProcess(context.Context, redis.Cmder) error { return nil }
+
+func (failingCommand) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (failingCommand) AfterProcessPipeline(context.Context, []redis.Cmder) error { return nil }
+
+func TestSchedulerSQSForward(t *testing.T) {
+	conn, srv := newTestSQS(t)
+	queueURL := srv.CreateQueue("agendadas", nil)
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	schedule := func(t *testing.T, s *SchedulerSQS) {
+		t.Helper()
+		member, _ := json.Marshal(scheduledSQS{ID: "m1", QueueURL: queueURL, Body: `{}`})
+		mr.ZAdd(s.Key, float64(time.Now().UnixMilli()), string(member))
+	}
+
+	t.Run("falha no envio devolve a mensagem ao conjunto", func(t *testing.T) {
+		s := NewSchedulerSQS(conn, redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+		schedule(t, s)
+		srv.FailNext("SendMessage", "InternalError", 1)
+		if err := s.forward(ctx); err == nil {
+			t.Fatal("esperava o erro do envio")
+		}
+		if members, _ := mr.ZMembers(s.Key); len(members) != 1 {
+			t.Errorf("mensagem deveria voltar ao conjunto, restam %d", len(members))
+		}
+	})
+
+	t.Run("falha ao reagendar é retornada", func(t *testing.T) {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+		client.AddHook(failingCommand("zadd"))
+		s := NewSchedulerSQS(conn, client)
+		srv.FailNext("SendMessage", "InternalError", 1)
+		err := s.forward(ctx)
+		if err == nil || !strings.Contains(err.Error(), "reschedule") {
+			t.Errorf("esperava erro ao reagendar, recebeu %v", err)
+		}
+	})
+
+	t.Run("encaminha mensagem vencida", func(t *testing.T) {
+		s := NewSchedulerSQS(conn, redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+		schedule(t, s)
+		if err := s.forward(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if members, _ := mr.ZMembers(s.Key); len(members) != 0 || srv.Len("agendadas") != 1 {
+			t.Errorf("esperava a mensagem na fila, restam %d no conjunto e %d na fila", len(members), srv.Len("agendadas"))
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package gorote
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// DLQSQS inspects and replays an SQS dead-letter queue. Messages are received
+// with VisibilityTimeout, long enough for a whole scan, and the ones left
+// untouched are made visible again when it ends.
+type DLQSQS struct {
+	Conn              ConnSQS
+	QueueURL          string
+	VisibilityTimeout time.Duration
+}
+
+func (s ConnSQS) DeadLetterQueue(queueURL string) *DLQSQS {
+	return &DLQSQS{Conn: s, QueueURL: queueURL, VisibilityTimeout: 5 * time.Minute}
+}
+
+func (q *DLQSQS) Count(ctx context.Context) (int, error) {
+	out, err := q.Conn.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(q.QueueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("falha ao consultar atributos da fila: %w", err)
+	}
+	return strconv.Atoi(out.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+}
+
+func (q *DLQSQS) Peek(ctx context.Context, limit int, filter DeadLetterFilter) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := q.scan(ctx, func(m types.Message, letter DeadLetter) (bool, bool, error) {
+		if filter.match(letter) {
+			letters = append(letters, letter)
+		}
+		return false, limit > 0 && len(letters) >= limit, nil
+	})
+	return letters, err
+}
+
+func (q *DLQSQS) Redrive(ctx context.Context, opts RedriveOptions) (*RedriveResult, error) {
+	result := &RedriveResult{}
+	wait := throttle(opts.Rate)
+	targets := make(map[string]string)
+	err := q.scan(ctx, func(m types.Message, letter DeadLetter) (bool, bool, error) {
+		if !opts.Filter.match(letter) {
+			result.Skipped++
+			return false, false, nil
+		}
+		target, err := q.target(ctx, opts.Target, letter.Source, targets)
+		if err != nil {
+			log.Printf("[SQS] Mensagem %s sem fila de origem, ignorada: %v", letter.ID, err)
+			result.Skipped++
+			return false, false, nil
+		}
+		if err := wait(ctx); err != nil {
+			return false, true, err
+		}
+
+		input := &sqs.SendMessageInput{
+			QueueUrl:          aws.String(target),
+			MessageBody:       m.Body,
+			MessageAttributes: m.MessageAttributes,
+		}
+		if IsFIFOQueue(target) {
+			input.MessageGroupId = aws.String(m.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)])
+			dedup := m.Attributes[string(types.MessageSystemAttributeNameMessageDeduplicationId)]
+			if dedup == "" {
+				dedup = letter.ID
+			}
+			input.MessageDeduplicationId = aws.String(dedup)
+		}
+		if _, err := q.Conn.SendMessage(ctx, input); err != nil {
+			return false, true, fmt.Errorf("falha ao reenviar mensagem %s: %w", letter.ID, err)
+		}
+		if _, err := q.Conn.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(q.QueueURL),
+			ReceiptHandle: m.ReceiptHandle,
+		}); err != nil {
+			return false, true, fmt.Errorf("falha ao remover mensagem %s: %w", letter.ID, err)
+		}
+		result.Moved++
+		return true, opts.Limit > 0 && result.Moved >= opts.Limit, nil
+	})
+	return result, err
+}
+
+// target resolves the queue URL a message is redriven to, from override or
+// from the ARN of its source queue.
+func (q *DLQSQS) target(ctx context.Context, override, sourceARN string, cache map[string]string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	if url, ok := cache[sourceARN]; ok {
+		return url, nil
+	}
+	// arn:aws:sqs:<region>:<account>:<name>
+	parts := strings.Split(sourceARN, ":")
+	if len(parts) != 6 {
+		return "", fmt.Errorf("invalid source queue arn %q", sourceARN)
+	}
+	out, err := q.Conn.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName:              aws.String(parts[5]),
+		QueueOwnerAWSAccountId: aws.String(parts[4]),
+	})
+	if err != nil {
+		return "", err
+	}
+	cache[sourceARN] = aws.ToString(out.QueueUrl)
+	return cache[sourceARN], nil
+}
+
+// scan calls visit for every message in the queue, each at most once, until
+// it reports done. visit returns whether it removed the message; the others
+// are made visible again when the scan ends.
+func (q *DLQSQS) scan(ctx context.Context, visit func(types.Message, DeadLetter) (removed, done bool, err error)) error {
+	var held []types.Message
+	defer func() {
+		release := context.WithoutCancel(ctx)
+		for _, m := range held {
+			q.Conn.changeVisibility(release, q.QueueURL, m, 0)
+		}
+	}()
+
+	seen := make(map[string]bool)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		out, err := q.Conn.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(q.QueueURL),
+			MaxNumberOfMessages:         maxBatchSQS,
+			WaitTimeSeconds:             1,
+			VisibilityTimeout:           int32(q.VisibilityTimeout / time.Second),
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameAll},
+			MessageAttributeNames:       []string{"All"},
+		})
+		if err != nil {
+			return fmt.Errorf("falha ao receber mensagens: %w", err)
+		}
+
+		fresh := 0
+		for _, m := range out.Messages {
+			id := aws.ToString(m.MessageId)
+			if seen[id] {
+				held = append(held, m)
+				continue
+			}
+			seen[id] = true
+			fresh++
+
+			removed, done, err := visit(m, deadLetterSQS(m))
+			if !removed {
+				held = append(held, m)
+			}
+			if err != nil || done {
+				return err
+			}
+		}
+		if fresh == 0 {
+			return nil
+		}
+	}
+}
+
+func deadLetterSQS(m types.Message) DeadLetter {
+	letter := DeadLetter{
+		ID:      aws.ToString(m.MessageId),
+		Body:    aws.ToString(m.Body),
+		Source:  m.Attributes[string(types.MessageSystemAttributeNameDeadLetterQueueSourceArn)],
+		Headers: make(map[string]string, len(m.Attributes)+len(m.MessageAttributes)),
+	}
+	for k, v := range m.Attributes {
+		letter.Headers[k] = v
+	}
+	for k, v := range m.MessageAttributes {
+		if v.StringValue != nil {
+			letter.Headers[k] = aws.ToString(v.StringValue)
+		}
+	}
+	if sent, err := strconv.ParseInt(m.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)], 10, 64); err == nil {
+		letter.Timestamp = time.UnixMilli(sent)
+	}
+	letter.Attempts, _ = strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+	return letter
+}
@@ -0,0 +1,229 @@
+package gorote
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+var ErrInvalidSignatureSNS = errors.New("invalid SNS signature")
+
+// SNSNotification is the envelope SNS wraps around messages delivered to SQS
+// when raw message delivery is disabled.
+type SNSNotification struct {
+	Type              string
+	MessageId         string
+	TopicArn          string
+	Subject           string `json:",omitempty"`
+	Message           string
+	Timestamp         string
+	SignatureVersion  string
+	Signature         string
+	SigningCertURL    string
+	UnsubscribeURL    string
+	MessageAttributes map[string]SNSMessageAttribute `json:",omitempty"`
+}
+
+type SNSMessageAttribute struct {
+	Type  string
+	Value string
+}
+
+// EventBridgeEvent is the envelope of events delivered by an EventBridge rule.
+type EventBridgeEvent struct {
+	Version    string          `json:"version"`
+	ID         string          `json:"id"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Account    string          `json:"account"`
+	Time       time.Time       `json:"time"`
+	Region     string          `json:"region"`
+	Resources  []string        `json:"resources"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// EnvelopeSQS describes how a message reached the queue. SNS and EventBridge
+// are nil when the body was not wrapped by them; both are set for EventBridge
+// events fanned out through SNS.
+type EnvelopeSQS struct {
+	Message     types.Message
+	SNS         *SNSNotification
+	EventBridge *EventBridgeEvent
+	// Payload is the innermost body, once every envelope is removed.
+	Payload []byte
+}
+
+// UnwrapSQS detects SNS notification and EventBridge envelopes in the body of
+// m and returns the payload they carry. Bodies without an envelope are
+// returned as is.
+func UnwrapSQS(m types.Message) *EnvelopeSQS {
+	env := &EnvelopeSQS{Message: m, Payload: []byte(aws.ToString(m.Body))}
+	if sns, ok := parseSNSNotification(env.Payload); ok {
+		env.SNS = sns
+		env.Payload = []byte(sns.Message)
+	}
+	if event, ok := parseEventBridgeEvent(env.Payload); ok {
+		env.EventBridge = event
+		env.Payload = event.Detail
+	}
+	return env
+}
+
+func parseSNSNotification(body []byte) (*SNSNotification, bool) {
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		return nil, false
+	}
+	var sns SNSNotification
+	if err := json.Unmarshal(body, &sns); err != nil {
+		return nil, false
+	}
+	if sns.Type != "Notification" || sns.TopicArn == "" || sns.MessageId == "" {
+		return nil, false
+	}
+	return &sns, true
+}
+
+func parseEventBridgeEvent(body []byte) (*EventBridgeEvent, bool) {
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		return nil, false
+	}
+	var event EventBridgeEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, false
+	}
+	if event.DetailType == "" || event.Source == "" || event.Detail == nil {
+		return nil, false
+	}
+	return &event, true
+}
+
+// HandleSQS adapts a typed function into a HandlesSQS. SNS and EventBridge
+// envelopes are removed and the payload is decoded as JSON into T, except for
+// string and []byte which receive it unchanged.
+func HandleSQS[T any](fn func(ctx context.Context, body T, env *EnvelopeSQS) error) HandlesSQS {
+	return func(ctx context.Context, m types.Message) error {
+		env := UnwrapSQS(m)
+		var body T
+		switch v := any(&body).(type) {
+		case *string:
+			*v = string(env.Payload)
+		case *[]byte:
+			*v = env.Payload
+		default:
+			if err := json.Unmarshal(env.Payload, &body); err != nil {
+				return fmt.Errorf("invalid message body: %w", err)
+			}
+		}
+		return fn(ctx, body, env)
+	}
+}
+
+var (
+	// ErrUnsignedSNS is returned by VerifySNS for bodies that are not SNS
+	// notifications, unless VerifySNSConfig.AllowUnsigned is set.
+	ErrUnsignedSNS = errors.New("message is not a signed SNS notification")
+	// ErrTopicSNS is returned by VerifySNS for notifications from topics not
+	// listed in VerifySNSConfig.TopicARNs.
+	ErrTopicSNS = errors.New("unexpected SNS topic")
+)
+
+type VerifySNSConfig struct {
+	// Certificate of the topic's signing key, downloaded from SigningCertURL
+	// and pinned by the application.
+	Certificate *x509.Certificate
+	// TopicARNs lists the topics whose notifications are accepted.
+	TopicARNs []string
+	// AllowUnsigned lets bodies without an SNS envelope through unverified,
+	// for queues that also receive messages sent directly to SQS.
+	AllowUnsigned bool
+}
+
+// VerifySNS rejects messages that are not SNS notifications from one of
+// config.TopicARNs with a valid signature. It returns an error when the
+// certificate or the topics are missing, since the check would be meaningless.
+func VerifySNS(config VerifySNSConfig) (MiddlewareSQS, error) {
+	if config.Certificate == nil || len(config.TopicARNs) == 0 {
+		return nil, fmt.Errorf("VerifySNS requires a certificate and at least one topic ARN")
+	}
+	return func(next HandlesSQS) HandlesSQS {
+		return func(ctx context.Context, m types.Message) error {
+			sns, ok := parseSNSNotification([]byte(aws.ToString(m.Body)))
+			if !ok {
+				if config.AllowUnsigned {
+					return next(ctx, m)
+				}
+				return ErrUnsignedSNS
+			}
+			if !slices.Contains(config.TopicARNs, sns.TopicArn) {
+				return fmt.Errorf("%w: %s", ErrTopicSNS, sns.TopicArn)
+			}
+			if err := sns.Verify(config.Certificate); err != nil {
+				return err
+			}
+			return next(ctx, m)
+		}
+	}, nil
+}
+
+// Verify checks the signature of n against cert. Signature versions 1
+// (SHA1withRSA) and 2 (SHA256withRSA) are supported.
+func (n *SNSNotification) Verify(cert *x509.Certificate) error {
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("SNS certificate must hold an RSA key")
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("SNS certificate is not valid at %s", now.Format(time.RFC3339))
+	}
+	signature, err := base64.StdEncoding.DecodeString(n.Signature)
+	if err != nil {
+		return ErrInvalidSignatureSNS
+	}
+
+	data := []byte(n.stringToSign())
+	switch n.SignatureVersion {
+	case "1":
+		sum := sha1.Sum(data)
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA1, sum[:], signature)
+	case "2":
+		sum := sha256.Sum256(data)
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature)
+	default:
+		return fmt.Errorf("unsupported SNS signature version %q", n.SignatureVersion)
+	}
+	if err != nil {
+		return ErrInvalidSignatureSNS
+	}
+	return nil
+}
+
+// stringToSign builds the canonical form SNS signs for notifications.
+func (n *SNSNotification) stringToSign() string {
+	var b bytes.Buffer
+	field := func(name, value string) {
+		b.WriteString(name + "\n" + value + "\n")
+	}
+	field("Message", n.Message)
+	field("MessageId", n.MessageId)
+	if n.Subject != "" {
+		field("Subject", n.Subject)
+	}
+	field("Timestamp", n.Timestamp)
+	field("TopicArn", n.TopicArn)
+	field("Type", n.Type)
+	return b.String()
+}
@@ -0,0 +1,139 @@
+package gorote
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+type pedidoCriado struct {
+	ID    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+func TestHandleSQSEnvelopes(t *testing.T) {
+	event := `{"version":"0","id":"e1","detail-type":"PedidoCriado","source":"loja","account":"1","time":"2024-01-01T00:00:00Z","region":"us-east-1","resources":[],"detail":{"id":"p1","total":10}}`
+	sns, _ := json.Marshal(SNSNotification{Type: "Notification", MessageId: "m1", TopicArn: "arn:aws:sns:us-east-1:1:pedidos", Message: event})
+
+	cases := map[string]string{
+		"corpo sem envelope":    `{"id":"p1","total":10}`,
+		"evento do eventbridge": event,
+		"eventbridge via sns":   string(sns),
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			var got pedidoCriado
+			handler := HandleSQS(func(ctx context.Context, p pedidoCriado, env *EnvelopeSQS) error {
+				got = p
+				return nil
+			})
+			if err := handler(context.Background(), types.Message{Body: aws.String(body)}); err != nil {
+				t.Fatalf("erro inesperado: %v", err)
+			}
+			if got != (pedidoCriado{ID: "p1", Total: 10}) {
+				t.Errorf("payload decodificado incorreto: %+v", got)
+			}
+		})
+	}
+}
+
+func TestVerifySNS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	n := SNSNotification{
+		Type:             "Notification",
+		MessageId:        "m1",
+		TopicArn:         "arn:aws:sns:us-east-1:1:pedidos",
+		Subject:          "novo",
+		Message:          `{"id":"p1","total":10}`,
+		Timestamp:        "2024-01-01T00:00:00.000Z",
+		SignatureVersion: "2",
+	}
+	sum := sha256.Sum256([]byte(n.stringToSign()))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	n.Signature = base64.StdEncoding.EncodeToString(signature)
+
+	verify, err := VerifySNS(VerifySNSConfig{Certificate: cert, TopicARNs: []string{"arn:aws:sns:us-east-1:1:pedidos"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := ChainSQS(HandleSQS(func(ctx context.Context, p pedidoCriado, env *EnvelopeSQS) error {
+		return nil
+	}), verify)
+
+	t.Run("configuração incompleta", func(t *testing.T) {
+		for _, config := range []VerifySNSConfig{{TopicARNs: []string{n.TopicArn}}, {Certificate: cert}} {
+			if _, err := VerifySNS(config); err == nil {
+				t.Errorf("esperava erro com configuração incompleta: %+v", config)
+			}
+		}
+	})
+
+	t.Run("assinatura válida", func(t *testing.T) {
+		body, _ := json.Marshal(n)
+		if err := handler(context.Background(), types.Message{Body: aws.String(string(body))}); err != nil {
+			t.Errorf("esperava assinatura válida, recebeu: %v", err)
+		}
+	})
+
+	t.Run("mensagem adulterada", func(t *testing.T) {
+		tampered := n
+		tampered.Message = `{"id":"p1","total":1000}`
+		body, _ := json.Marshal(tampered)
+		err := handler(context.Background(), types.Message{Body: aws.String(string(body))})
+		if !errors.Is(err, ErrInvalidSignatureSNS) {
+			t.Errorf("esperava ErrInvalidSignatureSNS, recebeu: %v", err)
+		}
+	})
+
+	t.Run("tópico inesperado", func(t *testing.T) {
+		other := n
+		other.TopicArn = "arn:aws:sns:us-east-1:1:outro"
+		body, _ := json.Marshal(other)
+		err := handler(context.Background(), types.Message{Body: aws.String(string(body))})
+		if !errors.Is(err, ErrTopicSNS) {
+			t.Errorf("esperava ErrTopicSNS, recebeu: %v", err)
+		}
+	})
+
+	t.Run("corpo sem envelope SNS", func(t *testing.T) {
+		raw := types.Message{Body: aws.String(`{"id":"p1","total":1000}`)}
+		if err := handler(context.Background(), raw); !errors.Is(err, ErrUnsignedSNS) {
+			t.Errorf("esperava ErrUnsignedSNS, recebeu: %v", err)
+		}
+		allow, err := VerifySNS(VerifySNSConfig{Certificate: cert, TopicARNs: []string{n.TopicArn}, AllowUnsigned: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := allow(func(context.Context, types.Message) error { return nil })(context.Background(), raw); err != nil {
+			t.Errorf("AllowUnsigned deveria aceitar o corpo, recebeu: %v", err)
+		}
+	})
+}
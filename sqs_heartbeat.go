@@ -0,0 +1,108 @@
+package gorote
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// maxVisibilitySQS is the longest a message can stay invisible after receive.
+const maxVisibilitySQS = 12 * time.Hour
+
+// HeartbeatSQS keeps a message invisible while its handler runs by calling
+// ChangeMessageVisibility every Interval. Set it on ConnSQS.Heartbeat to apply
+// it to ConsumerMessages.
+type HeartbeatSQS struct {
+	// VisibilityTimeout is the timeout messages are received with. Defaults to
+	// ConsumerOptionsSQS.VisibilityTimeout on consumers, or to 30s, the SQS
+	// default.
+	VisibilityTimeout time.Duration
+	// Interval between extensions. Defaults to a third of VisibilityTimeout,
+	// so the first extension lands well before the message reappears.
+	Interval time.Duration
+	// Extension is the visibility timeout set on each beat. Defaults to twice
+	// Interval.
+	Extension time.Duration
+	// Max stops extending once the handler ran this long. Defaults to the SQS
+	// limit of 12h.
+	Max time.Duration
+	// KeepOnFailure leaves a failed message invisible until its timeout
+	// expires, e.g. to space out retries. By default it is made visible again
+	// right away.
+	KeepOnFailure bool
+}
+
+func (cfg HeartbeatSQS) withDefaults() HeartbeatSQS {
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = 30 * time.Second
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = max(cfg.VisibilityTimeout/3, time.Second)
+	}
+	if cfg.Extension <= cfg.Interval {
+		cfg.Extension = 2 * cfg.Interval
+	}
+	if cfg.Max <= 0 || cfg.Max > maxVisibilitySQS {
+		cfg.Max = maxVisibilitySQS
+	}
+	return cfg
+}
+
+// VisibilityHeartbeat returns a middleware extending the visibility of
+// messages from queueURL while the wrapped handler runs.
+func (s ConnSQS) VisibilityHeartbeat(queueURL string, cfg HeartbeatSQS) MiddlewareSQS {
+	cfg = cfg.withDefaults()
+	return func(next HandlesSQS) HandlesSQS {
+		return func(ctx context.Context, m types.Message) error {
+			beatCtx, stop := context.WithCancel(ctx)
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.beat(beatCtx, queueURL, m, cfg)
+			}()
+
+			err := next(ctx, m)
+			stop()
+			wg.Wait()
+
+			if err != nil && !cfg.KeepOnFailure {
+				s.changeVisibility(context.WithoutCancel(ctx), queueURL, m, 0)
+			}
+			return err
+		}
+	}
+}
+
+func (s ConnSQS) beat(ctx context.Context, queueURL string, m types.Message, cfg HeartbeatSQS) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	started := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if time.Since(started)+cfg.Extension > cfg.Max {
+				return
+			}
+			s.changeVisibility(ctx, queueURL, m, cfg.Extension)
+		}
+	}
+}
+
+func (s ConnSQS) changeVisibility(ctx context.Context, queueURL string, m types.Message, timeout time.Duration) {
+	_, err := s.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(queueURL),
+		ReceiptHandle:     m.ReceiptHandle,
+		VisibilityTimeout: int32(timeout / time.Second),
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("[SQS] Erro ao alterar visibilidade da mensagem %s: %v", aws.ToString(m.MessageId), err)
+	}
+}
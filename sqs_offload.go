@@ -0,0 +1,139 @@
+package gorote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/go-gorote/gorote/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	payloadPointerClass     = "software.amazon.payloadoffloading.PayloadS3Pointer"
+	extendedPayloadSizeAttr = "ExtendedPayloadSize"
+)
+
+// OffloadSQS stores message bodies larger than Threshold in object storage and
+// sends a pointer instead, using the same format as the AWS SQS Extended
+// Client. Set it on ConnSQS.Offload: Send and SendBatch upload large bodies
+// and the consumers download them before calling the handler.
+type OffloadSQS struct {
+	// Storage must implement storage.PayloadStore for consumers to download
+	// offloaded bodies; producers only need Upload.
+	Storage storage.StorageProvider
+	Bucket  string
+	Prefix  string
+	// Threshold in bytes above which bodies are offloaded. Defaults to
+	// MaxPayloadSQS.
+	Threshold int
+	// Cleanup deletes the stored body once the message is deleted from SQS.
+	Cleanup bool
+}
+
+type payloadPointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+func (o *OffloadSQS) threshold() int {
+	if o.Threshold <= 0 {
+		return MaxPayloadSQS
+	}
+	return o.Threshold
+}
+
+// offload uploads enc.body when it is over the threshold and replaces it with
+// a pointer.
+func (o *OffloadSQS) offload(ctx context.Context, enc *encodedSQS) error {
+	if o == nil || enc.size <= o.threshold() {
+		return nil
+	}
+	key := o.Prefix + uuid.NewString()
+	if err := o.Storage.Upload(ctx, o.Bucket, key, strings.NewReader(enc.body), "application/octet-stream"); err != nil {
+		return fmt.Errorf("failed to offload payload: %w", err)
+	}
+	pointer, err := json.Marshal([]any{payloadPointerClass, payloadPointer{Bucket: o.Bucket, Key: key}})
+	if err != nil {
+		return err
+	}
+
+	size := strconv.Itoa(len(enc.body))
+	if enc.attributes == nil {
+		enc.attributes = make(map[string]types.MessageAttributeValue, 1)
+	}
+	enc.attributes[extendedPayloadSizeAttr] = types.MessageAttributeValue{
+		DataType:    aws.String("Number"),
+		StringValue: aws.String(size),
+	}
+	enc.size += len(pointer) - len(enc.body) + len(extendedPayloadSizeAttr) + len("Number") + len(size)
+	enc.body = string(pointer)
+	return nil
+}
+
+func parsePayloadPointer(body string) (payloadPointer, bool) {
+	if !strings.HasPrefix(body, `["`+payloadPointerClass) {
+		return payloadPointer{}, false
+	}
+	var raw []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &raw); err != nil || len(raw) != 2 {
+		return payloadPointer{}, false
+	}
+	var pointer payloadPointer
+	if err := json.Unmarshal(raw[1], &pointer); err != nil || pointer.Key == "" {
+		return payloadPointer{}, false
+	}
+	return pointer, true
+}
+
+// resolve returns m with its body fetched from storage when it is a pointer.
+func (o *OffloadSQS) resolve(ctx context.Context, m types.Message) (types.Message, error) {
+	if o == nil {
+		return m, nil
+	}
+	pointer, ok := parsePayloadPointer(aws.ToString(m.Body))
+	if !ok {
+		return m, nil
+	}
+	store, ok := o.Storage.(storage.PayloadStore)
+	if !ok {
+		return m, fmt.Errorf("storage %T cannot download offloaded payloads", o.Storage)
+	}
+	r, err := store.Download(ctx, pointer.Bucket, pointer.Key)
+	if err != nil {
+		return m, fmt.Errorf("failed to fetch offloaded payload: %w", err)
+	}
+	defer r.Close()
+	var body bytes.Buffer
+	if _, err := io.Copy(&body, r); err != nil {
+		return m, fmt.Errorf("failed to read offloaded payload: %w", err)
+	}
+	m.Body = aws.String(body.String())
+	return m, nil
+}
+
+// cleanup removes the stored body of a deleted message when Cleanup is set.
+func (o *OffloadSQS) cleanup(ctx context.Context, m types.Message) {
+	if o == nil || !o.Cleanup {
+		return
+	}
+	pointer, ok := parsePayloadPointer(aws.ToString(m.Body))
+	if !ok {
+		return
+	}
+	store, ok := o.Storage.(storage.PayloadStore)
+	if !ok {
+		log.Printf("[SQS] Storage %T não remove payloads, %s/%s mantido", o.Storage, pointer.Bucket, pointer.Key)
+		return
+	}
+	if err := store.Delete(ctx, pointer.Bucket, pointer.Key); err != nil {
+		log.Printf("[SQS] Erro ao remover payload %s/%s: %v", pointer.Bucket, pointer.Key, err)
+	}
+}
@@ -0,0 +1,83 @@
+package gorote
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// uploadOnlyStorage implements storage.StorageProvider but not PayloadStore.
+type uploadOnlyStorage struct {
+	objects map[string][]byte
+}
+
+func (s *uploadOnlyStorage) Upload(_ context.Context, bucket, key string, file io.Reader, _ string) error {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	s.objects[bucket+"/"+key] = data
+	return nil
+}
+
+func (s *uploadOnlyStorage) GetPresignedURL(context.Context, string, string, time.Duration) (string, error) {
+	return "", nil
+}
+
+type memoryPayloadStore struct {
+	uploadOnlyStorage
+}
+
+func (s *memoryPayloadStore) Download(_ context.Context, bucket, key string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(s.objects[bucket+"/"+key])), nil
+}
+
+func (s *memoryPayloadStore) Delete(_ context.Context, bucket, key string) error {
+	delete(s.objects, bucket+"/"+key)
+	return nil
+}
+
+func TestOffloadSQS(t *testing.T) {
+	ctx := context.Background()
+	body := strings.Repeat("x", 100)
+	offloaded := func(o *OffloadSQS) types.Message {
+		enc, err := MessageSQS{Body: body}.encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.offload(ctx, &enc); err != nil {
+			t.Fatal(err)
+		}
+		return types.Message{Body: aws.String(enc.body)}
+	}
+
+	t.Run("payload store baixa e remove o corpo", func(t *testing.T) {
+		store := &memoryPayloadStore{uploadOnlyStorage{objects: map[string][]byte{}}}
+		o := &OffloadSQS{Storage: store, Bucket: "payloads", Threshold: 10, Cleanup: true}
+		m := offloaded(o)
+		if aws.ToString(m.Body) == body || len(store.objects) != 1 {
+			t.Fatalf("corpo deveria ter sido enviado ao storage, recebeu %s", aws.ToString(m.Body))
+		}
+		resolved, err := o.resolve(ctx, m)
+		if err != nil || aws.ToString(resolved.Body) != body {
+			t.Fatalf("esperava o corpo original, recebeu %q %v", aws.ToString(resolved.Body), err)
+		}
+		o.cleanup(ctx, m)
+		if len(store.objects) != 0 {
+			t.Errorf("payload deveria ter sido removido")
+		}
+	})
+
+	t.Run("storage sem download retorna erro", func(t *testing.T) {
+		o := &OffloadSQS{Storage: &uploadOnlyStorage{objects: map[string][]byte{}}, Bucket: "payloads", Threshold: 10}
+		if _, err := o.resolve(ctx, offloaded(o)); err == nil {
+			t.Error("esperava erro ao resolver com storage sem Download")
+		}
+	})
+}
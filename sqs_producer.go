@@ -0,0 +1,307 @@
+package gorote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const (
+	// MaxPayloadSQS is the largest message (body plus attributes) SQS accepts,
+	// and also the limit for the sum of all messages in a batch.
+	MaxPayloadSQS = 256 * 1024
+	maxBatchSQS   = 10
+)
+
+// MessageSQS is a message to send with ConnSQS.Send or SendBatch. Bodies over
+// MaxPayloadSQS are rejected unless ConnSQS.Offload is set.
+type MessageSQS struct {
+	// Body is sent as is when it is a string or []byte, otherwise as JSON.
+	Body any
+	// GroupID is required on FIFO queues.
+	GroupID string
+	// DeduplicationID is only used on FIFO queues. Defaults to a SHA-256 of
+	// the body, taken before any offload so equal payloads share it.
+	DeduplicationID string
+	Attributes      map[string]string
+	Delay           time.Duration
+}
+
+type encodedSQS struct {
+	body       string
+	attributes map[string]types.MessageAttributeValue
+	size       int
+	// digest is the SHA-256 of the original body.
+	digest string
+}
+
+func (m MessageSQS) encode() (encodedSQS, error) {
+	var body string
+	switch v := m.Body.(type) {
+	case string:
+		body = v
+	case []byte:
+		body = string(v)
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return encodedSQS{}, fmt.Errorf("failed to serialize struct: %w", err)
+		}
+		body = string(raw)
+	}
+
+	sum := sha256.Sum256([]byte(body))
+	enc := encodedSQS{body: body, size: len(body), digest: hex.EncodeToString(sum[:])}
+	if len(m.Attributes) > 0 {
+		enc.attributes = make(map[string]types.MessageAttributeValue, len(m.Attributes))
+		for k, v := range m.Attributes {
+			enc.attributes[k] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+			enc.size += len(k) + len("String") + len(v)
+		}
+	}
+	return enc, nil
+}
+
+func (e encodedSQS) check() error {
+	if e.size > MaxPayloadSQS {
+		return fmt.Errorf("message size %d exceeds SQS limit of %d bytes", e.size, MaxPayloadSQS)
+	}
+	return nil
+}
+
+// prepare encodes msg, offloading its body when ConnSQS.Offload is set.
+func (s ConnSQS) prepare(ctx context.Context, msg MessageSQS) (encodedSQS, error) {
+	enc, err := msg.encode()
+	if err != nil {
+		return enc, err
+	}
+	if err := s.Offload.offload(ctx, &enc); err != nil {
+		return enc, err
+	}
+	return enc, enc.check()
+}
+
+func (m MessageSQS) fifoIDs(queueURL string, enc encodedSQS) (group, dedup *string, err error) {
+	if m.GroupID != "" {
+		group = aws.String(m.GroupID)
+	}
+	if !IsFIFOQueue(queueURL) {
+		return group, nil, nil
+	}
+	if m.GroupID == "" {
+		return nil, nil, fmt.Errorf("message group id is required for FIFO queue")
+	}
+	if m.Delay > 0 {
+		return nil, nil, ErrDelayFIFO
+	}
+	if m.DeduplicationID != "" {
+		return group, aws.String(m.DeduplicationID), nil
+	}
+	return group, aws.String(enc.digest), nil
+}
+
+// delaySeconds rounds d up to whole seconds, so a message is never delivered
+// before its delay.
+func delaySeconds(d time.Duration) int32 {
+	return int32((d + time.Second - 1) / time.Second)
+}
+
+func IsFIFOQueue(queueURL string) bool {
+	return strings.HasSuffix(queueURL, ".fifo")
+}
+
+// Send sends msg to queueURL and returns the SQS message ID.
+func (s ConnSQS) Send(ctx context.Context, queueURL string, msg MessageSQS) (string, error) {
+	enc, err := s.prepare(ctx, msg)
+	if err != nil {
+		return "", err
+	}
+	group, dedup, err := msg.fifoIDs(queueURL, enc)
+	if err != nil {
+		return "", err
+	}
+	out, err := s.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:               aws.String(queueURL),
+		MessageBody:            aws.String(enc.body),
+		MessageAttributes:      enc.attributes,
+		MessageGroupId:         group,
+		MessageDeduplicationId: dedup,
+		DelaySeconds:           delaySeconds(msg.Delay),
+	})
+	if err != nil {
+		return "", fmt.Errorf("falha ao enviar mensagem para a fila: %w", err)
+	}
+	return aws.ToString(out.MessageId), nil
+}
+
+// BatchFailureSQS describes a message of SendBatch that was not sent. Index
+// refers to the position in the slice given to SendBatch.
+type BatchFailureSQS struct {
+	Index       int
+	Code        string
+	Message     string
+	SenderFault bool
+}
+
+type BatchResultSQS struct {
+	// MessageIDs maps the index of each sent message to its SQS message ID.
+	MessageIDs map[int]string
+	Failed     []BatchFailureSQS
+}
+
+// SendBatch sends msgs using as few SendMessageBatch calls as possible, each
+// limited to 10 entries and MaxPayloadSQS bytes. Messages rejected locally or
+// by SQS are reported in Failed; the error is only set when a call fails as a
+// whole, in which case the result covers the chunks sent before it.
+func (s ConnSQS) SendBatch(ctx context.Context, queueURL string, msgs []MessageSQS) (*BatchResultSQS, error) {
+	result := &BatchResultSQS{MessageIDs: make(map[int]string, len(msgs))}
+
+	var entries []types.SendMessageBatchRequestEntry
+	size := 0
+	flush := func() error {
+		if len(entries) == 0 {
+			return nil
+		}
+		out, err := s.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+		entries, size = nil, 0
+		if err != nil {
+			return fmt.Errorf("falha ao enviar lote para a fila: %w", err)
+		}
+		for _, ok := range out.Successful {
+			index, _ := strconv.Atoi(aws.ToString(ok.Id))
+			result.MessageIDs[index] = aws.ToString(ok.MessageId)
+		}
+		for _, failed := range out.Failed {
+			index, _ := strconv.Atoi(aws.ToString(failed.Id))
+			result.Failed = append(result.Failed, BatchFailureSQS{
+				Index:       index,
+				Code:        aws.ToString(failed.Code),
+				Message:     aws.ToString(failed.Message),
+				SenderFault: failed.SenderFault,
+			})
+		}
+		return nil
+	}
+
+	for i, msg := range msgs {
+		enc, err := s.prepare(ctx, msg)
+		if err == nil {
+			var group, dedup *string
+			group, dedup, err = msg.fifoIDs(queueURL, enc)
+			if err == nil {
+				if len(entries) == maxBatchSQS || size+enc.size > MaxPayloadSQS {
+					if err := flush(); err != nil {
+						return result, err
+					}
+				}
+				entries = append(entries, types.SendMessageBatchRequestEntry{
+					Id:                     aws.String(strconv.Itoa(i)),
+					MessageBody:            aws.String(enc.body),
+					MessageAttributes:      enc.attributes,
+					MessageGroupId:         group,
+					MessageDeduplicationId: dedup,
+					DelaySeconds:           delaySeconds(msg.Delay),
+				})
+				size += enc.size
+				continue
+			}
+		}
+		result.Failed = append(result.Failed, BatchFailureSQS{
+			Index:       i,
+			Code:        "InvalidMessage",
+			Message:     err.Error(),
+			SenderFault: true,
+		})
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+	slices.SortFunc(result.Failed, func(a, b BatchFailureSQS) int { return a.Index - b.Index })
+	return result, nil
+}
+
+// ConsumerFIFO consumes a FIFO queue preserving the order of each message
+// group: messages are routed to a worker by hashing their MessageGroupId and
+// every worker handles its messages one at a time. Success and failure are
+// handled as in ConsumerMessages, except that after a failure the messages of
+// the same group left in the received batch are released untouched, so SQS
+// redelivers them after the failed one.
+func (s ConnSQS) ConsumerFIFO(ctx context.Context, opts ConsumerOptionsSQS, handler HandlesSQS) error {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(opts.AttributeNames, types.MessageSystemAttributeNameMessageGroupId) {
+		opts.AttributeNames = append(slices.Clone(opts.AttributeNames), types.MessageSystemAttributeNameMessageGroupId)
+	}
+	handle, stop := s.messageHandler(ctx, opts, handler)
+	defer stop()
+
+	// Each lane receives the messages of one group from one batch, in order.
+	lanes := make([]chan []types.Message, opts.Workers)
+	var wg sync.WaitGroup
+	for i := range lanes {
+		lanes[i] = make(chan []types.Message, opts.MaxMessages)
+		wg.Add(1)
+		go func(lane <-chan []types.Message) {
+			defer wg.Done()
+			for group := range lane {
+				for i, m := range group {
+					if handle(ctx, m) != nil {
+						s.releaseMessages(context.WithoutCancel(ctx), opts.QueueURL, group[i+1:])
+						break
+					}
+				}
+			}
+		}(lanes[i])
+	}
+
+	err = s.runPollers(ctx, opts, func(batch []types.Message) bool {
+		var order []string
+		groups := make(map[string][]types.Message)
+		for _, m := range batch {
+			id := m.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]
+			if _, ok := groups[id]; !ok {
+				order = append(order, id)
+			}
+			groups[id] = append(groups[id], m)
+		}
+		for _, id := range order {
+			h := fnv.New32a()
+			h.Write([]byte(id))
+			select {
+			case <-ctx.Done():
+				return false
+			case lanes[h.Sum32()%uint32(len(lanes))] <- groups[id]:
+			}
+		}
+		return true
+	})
+	for _, lane := range lanes {
+		close(lane)
+	}
+	wg.Wait()
+	return err
+}
+
+// releaseMessages makes msgs visible again without handling them.
+func (s ConnSQS) releaseMessages(ctx context.Context, queueURL string, msgs []types.Message) {
+	for _, m := range msgs {
+		s.changeVisibility(ctx, queueURL, m, 0)
+	}
+}
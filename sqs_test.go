@@ -0,0 +1,294 @@
+package gorote
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/go-gorote/gorote/sqstest"
+)
+
+func newTestSQS(t *testing.T) (*ConnSQS, *sqstest.Server) {
+	t.Helper()
+	srv := sqstest.NewServer()
+	t.Cleanup(srv.Close)
+
+	init := InitSQS{
+		Region:          sqstest.Region,
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		Endpoint:        srv.URL,
+	}
+	conn, err := init.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("erro ao conectar no SQS falso: %v", err)
+	}
+	return conn, srv
+}
+
+func TestConsumerMessagesSQS(t *testing.T) {
+	conn, srv := newTestSQS(t)
+	queueURL := srv.CreateQueue("pedidos", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := conn.Send(ctx, queueURL, MessageSQS{Body: "a"}); err != nil {
+		t.Fatalf("erro ao enviar mensagem: %v", err)
+	}
+	result, err := conn.SendBatch(ctx, queueURL, []MessageSQS{{Body: "b"}, {Body: "c"}})
+	if err != nil || len(result.Failed) > 0 || len(result.MessageIDs) != 2 {
+		t.Fatalf("erro ao enviar lote: %v %+v", err, result)
+	}
+
+	var mu sync.Mutex
+	var received []string
+	go func() {
+		for srv.Len("pedidos") > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+	err = conn.ConsumerMessages(ctx, ConsumerOptionsSQS{QueueURL: queueURL, WaitTime: time.Second}, func(ctx context.Context, m types.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, aws.ToString(m.Body))
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "contexto encerrado") {
+		t.Errorf("esperava encerramento pelo contexto, recebeu: %v", err)
+	}
+
+	sort.Strings(received)
+	if strings.Join(received, ",") != "a,b,c" {
+		t.Errorf("mensagens recebidas inesperadas: %v", received)
+	}
+	if n := srv.Len("pedidos"); n != 0 {
+		t.Errorf("esperava fila vazia após processamento, restaram %d", n)
+	}
+}
+
+func TestConsumerMessagesSQSQueueNotFound(t *testing.T) {
+	conn, srv := newTestSQS(t)
+
+	err := conn.ConsumerMessages(context.Background(), ConsumerOptionsSQS{QueueURL: srv.QueueURL("inexistente")}, func(ctx context.Context, m types.Message) error {
+		return nil
+	})
+	var notFound *types.QueueDoesNotExist
+	if !errors.As(err, &notFound) {
+		t.Errorf("esperava QueueDoesNotExist, recebeu: %v", err)
+	}
+}
+
+func TestConsumerMessagesSQSPollers(t *testing.T) {
+	conn, srv := newTestSQS(t)
+	handler := func(context.Context, types.Message) error { return nil }
+
+	t.Run("vários pollers consomem a fila", func(t *testing.T) {
+		queueURL := srv.CreateQueue("pollers", nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		for i := 0; i < 3; i++ {
+			if _, err := conn.SendBatch(ctx, queueURL, []MessageSQS{{Body: "a"}, {Body: "b"}, {Body: "c"}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		go func() {
+			for srv.Len("pollers") > 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+			cancel()
+		}()
+		var mu sync.Mutex
+		received := 0
+		conn.ConsumerMessages(ctx, ConsumerOptionsSQS{QueueURL: queueURL, Pollers: 3, MaxMessages: 1, WaitTime: time.Second}, func(context.Context, types.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received++
+			return nil
+		})
+		if received != 9 || srv.Len("pollers") != 0 {
+			t.Errorf("esperava 9 mensagens processadas, recebeu %d, restam %d", received, srv.Len("pollers"))
+		}
+	})
+
+	t.Run("fila inexistente encerra todos os pollers", func(t *testing.T) {
+		queueURL := srv.CreateQueue("removida", nil)
+		srv.FailNext("ReceiveMessage", "QueueDoesNotExist", 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := conn.ConsumerMessages(ctx, ConsumerOptionsSQS{QueueURL: queueURL, Pollers: 3, WaitTime: 20 * time.Second}, handler)
+		var notFound *types.QueueDoesNotExist
+		if !errors.As(err, &notFound) || ctx.Err() != nil {
+			t.Errorf("esperava QueueDoesNotExist antes do timeout, recebeu: %v", err)
+		}
+	})
+
+	t.Run("falha no ReceiveMessage tenta de novo com backoff", func(t *testing.T) {
+		queueURL := srv.CreateQueue("instavel", nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := conn.Send(ctx, queueURL, MessageSQS{Body: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		srv.FailNext("ReceiveMessage", "InternalError", 2)
+		start := time.Now()
+		var elapsed time.Duration
+		opts := ConsumerOptionsSQS{QueueURL: queueURL, WaitTime: time.Second, RetryBackoff: 50 * time.Millisecond, MaxRetryBackoff: time.Second}
+		conn.ConsumerMessages(ctx, opts, func(context.Context, types.Message) error {
+			elapsed = time.Since(start)
+			cancel()
+			return nil
+		})
+		// Two failures wait 50ms and then 100ms before the receive succeeds.
+		if elapsed < 150*time.Millisecond {
+			t.Errorf("esperava ao menos 150ms de backoff, recebeu a mensagem em %s", elapsed)
+		}
+	})
+
+	t.Run("falha persistente não encerra o consumidor", func(t *testing.T) {
+		queueURL := srv.CreateQueue("fora-do-ar", nil)
+		srv.FailNext("ReceiveMessage", "InternalError", -1)
+		defer srv.FailNext("ReceiveMessage", "", 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		opts := ConsumerOptionsSQS{QueueURL: queueURL, Pollers: 2, RetryBackoff: 10 * time.Millisecond, MaxRetryBackoff: 20 * time.Millisecond}
+		err := conn.ConsumerMessages(ctx, opts, handler)
+		if err == nil || !strings.Contains(err.Error(), "contexto encerrado") {
+			t.Errorf("esperava encerramento pelo contexto, recebeu: %v", err)
+		}
+	})
+}
+
+func TestDeadLetterQueueSQS(t *testing.T) {
+	conn, srv := newTestSQS(t)
+	ctx := context.Background()
+	srv.CreateQueue("pedidos-dlq", nil)
+	queueURL := srv.CreateQueue("pedidos", map[string]string{
+		"RedrivePolicy": `{"deadLetterTargetArn":"` + sqstest.QueueARN("pedidos-dlq") + `","maxReceiveCount":"1"}`,
+	})
+
+	for _, tenant := range []string{"acme", "acme", "outro"} {
+		if _, err := conn.Send(ctx, queueURL, MessageSQS{Body: tenant, Attributes: map[string]string{"tenant": tenant}}); err != nil {
+			t.Fatalf("erro ao enviar mensagem: %v", err)
+		}
+	}
+	// A primeira leitura esgota as tentativas; a segunda move tudo para a DLQ.
+	for i := 0; i < 2; i++ {
+		if _, err := conn.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL), MaxNumberOfMessages: 10}); err != nil {
+			t.Fatalf("erro ao receber mensagens: %v", err)
+		}
+		srv.ExpireVisibility("pedidos")
+	}
+
+	dlq := conn.DeadLetterQueue(srv.QueueURL("pedidos-dlq"))
+	if n, err := dlq.Count(ctx); err != nil || n != 3 {
+		t.Fatalf("esperava 3 mensagens na DLQ, recebeu %d (%v)", n, err)
+	}
+
+	var out strings.Builder
+	n, err := ExportDeadLetters(ctx, dlq, &out, 0, HeaderFilter("tenant", "acme"))
+	if err != nil || n != 2 || strings.Count(out.String(), "\n") != 2 {
+		t.Fatalf("exportação inesperada: %d %v\n%s", n, err, out.String())
+	}
+	if !strings.Contains(out.String(), `"source":"`+sqstest.QueueARN("pedidos")+`"`) {
+		t.Errorf("esperava fila de origem na exportação: %s", out.String())
+	}
+
+	result, err := dlq.Redrive(ctx, RedriveOptions{Filter: HeaderFilter("tenant", "acme"), Rate: 100})
+	if err != nil || result.Moved != 2 || result.Skipped != 1 {
+		t.Fatalf("redrive inesperado: %+v %v", result, err)
+	}
+	if srv.Len("pedidos") != 2 || srv.Len("pedidos-dlq") != 1 {
+		t.Errorf("esperava 2 mensagens na fila e 1 na DLQ, restaram %d e %d", srv.Len("pedidos"), srv.Len("pedidos-dlq"))
+	}
+}
+
+func TestConsumerFIFOSQS(t *testing.T) {
+	conn, srv := newTestSQS(t)
+	queueURL := srv.CreateQueue("pedidos.fifo", map[string]string{"FifoQueue": "true"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var msgs []MessageSQS
+	for _, body := range []string{"1", "2", "3", "4"} {
+		msgs = append(msgs, MessageSQS{Body: body, GroupID: "cliente-1", DeduplicationID: body})
+	}
+	if result, err := conn.SendBatch(ctx, queueURL, msgs); err != nil || len(result.Failed) > 0 {
+		t.Fatalf("erro ao enviar lote: %v %+v", err, result)
+	}
+	if err := conn.SendDelayed(ctx, queueURL, "x", time.Second); !errors.Is(err, ErrDelayFIFO) {
+		t.Errorf("esperava ErrDelayFIFO, recebeu %v", err)
+	}
+
+	var received []string
+	failed := false
+	go func() {
+		for srv.Len("pedidos.fifo") > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+	opts := ConsumerOptionsSQS{
+		QueueURL: queueURL,
+		WaitTime: time.Second,
+		ErrorHandlers: []HandlesSQS{func(ctx context.Context, m types.Message) error {
+			conn.changeVisibility(ctx, queueURL, m, 0)
+			return nil
+		}},
+	}
+	conn.ConsumerFIFO(ctx, opts, func(ctx context.Context, m types.Message) error {
+		body := aws.ToString(m.Body)
+		received = append(received, body)
+		if body == "2" && !failed {
+			failed = true
+			return errors.New("falha temporária")
+		}
+		return nil
+	})
+
+	if got := strings.Join(received, ","); got != "1,2,2,3,4" {
+		t.Errorf("ordem do grupo não foi preservada após falha: %s", got)
+	}
+}
+
+func TestVisibilityHeartbeatSQS(t *testing.T) {
+	cfg := HeartbeatSQS{VisibilityTimeout: time.Minute}.withDefaults()
+	if cfg.Interval != 20*time.Second || cfg.Extension != 40*time.Second {
+		t.Errorf("intervalo deveria derivar do visibility timeout, recebeu %+v", cfg)
+	}
+
+	conn, srv := newTestSQS(t)
+	conn.Heartbeat = &HeartbeatSQS{}
+	queueURL := srv.CreateQueue("pagamentos", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := conn.Send(ctx, queueURL, MessageSQS{Body: "p1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	go func() {
+		for srv.Len("pagamentos") > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+	opts := ConsumerOptionsSQS{QueueURL: queueURL, WaitTime: time.Second, Workers: 1, VisibilityTimeout: 30 * time.Second}
+	conn.ConsumerMessages(ctx, opts, func(ctx context.Context, m types.Message) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("falha temporária")
+		}
+		return nil
+	})
+	if ctx.Err() == context.DeadlineExceeded || attempts != 2 {
+		t.Errorf("mensagem com falha deveria voltar à fila imediatamente, tentativas: %d", attempts)
+	}
+}
@@ -0,0 +1,741 @@
+// Package sqstest provides an in-memory SQS stand-in for tests. It speaks the
+// JSON protocol used by aws-sdk-go-v2 and implements the subset of operations
+// gorote relies on: queue creation and lookup, send, receive, delete,
+// visibility changes and queue attributes. Signatures are not checked.
+package sqstest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// AccountID is the account used in queue URLs and ARNs.
+	AccountID = "000000000000"
+	// Region is the region used in queue ARNs.
+	Region = "us-east-1"
+
+	defaultVisibility = 30 * time.Second
+	dedupWindow       = 5 * time.Minute
+)
+
+// Server is a fake SQS endpoint. Point the client at Server.URL, e.g. through
+// gorote.InitSQS.Endpoint.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	queues   map[string]*queue
+	notify   chan struct{}
+	failures map[string]*failure
+}
+
+type failure struct {
+	code  string
+	times int
+}
+
+type queue struct {
+	name       string
+	attributes map[string]string
+	messages   []*message
+	dedup      map[string]time.Time
+}
+
+type message struct {
+	id            string
+	body          string
+	attributes    map[string]json.RawMessage
+	groupID       string
+	sentAt        time.Time
+	visibleAt     time.Time
+	firstReceive  time.Time
+	receiveCount  int
+	receiptHandle string
+	sourceARN     string
+}
+
+// NewServer starts a Server. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		queues:   make(map[string]*queue),
+		notify:   make(chan struct{}),
+		failures: make(map[string]*failure),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// QueueURL returns the URL of the queue called name, whether it exists or not.
+func (s *Server) QueueURL(name string) string {
+	return s.URL + "/" + AccountID + "/" + name
+}
+
+// QueueARN returns the ARN of the queue called name.
+func QueueARN(name string) string {
+	return "arn:aws:sqs:" + Region + ":" + AccountID + ":" + name
+}
+
+// CreateQueue creates the queue called name, if needed, and returns its URL.
+func (s *Server) CreateQueue(name string, attributes map[string]string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.createQueue(name, attributes)
+	return s.QueueURL(name)
+}
+
+// Len returns the number of messages in the queue called name, including
+// in-flight and delayed ones.
+func (s *Server) Len(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.queues[name]; ok {
+		return len(q.messages)
+	}
+	return 0
+}
+
+// Bodies returns the bodies of the messages in the queue called name.
+func (s *Server) Bodies(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.queues[name]
+	if !ok {
+		return nil
+	}
+	bodies := make([]string, len(q.messages))
+	for i, m := range q.messages {
+		bodies[i] = m.body
+	}
+	return bodies
+}
+
+// ExpireVisibility makes every in-flight message of the queue called name
+// visible again, as if its visibility timeout had elapsed.
+func (s *Server) ExpireVisibility(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.queues[name]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	for _, m := range q.messages {
+		if m.visibleAt.After(now) && m.receiveCount > 0 {
+			m.visibleAt = now
+		}
+	}
+	s.wake()
+}
+
+func (s *Server) createQueue(name string, attributes map[string]string) *queue {
+	if q, ok := s.queues[name]; ok {
+		return q
+	}
+	q := &queue{
+		name:       name,
+		attributes: map[string]string{"QueueArn": QueueARN(name)},
+		dedup:      make(map[string]time.Time),
+	}
+	for k, v := range attributes {
+		q.attributes[k] = v
+	}
+	if strings.HasSuffix(name, ".fifo") {
+		q.attributes["FifoQueue"] = "true"
+	}
+	s.queues[name] = q
+	return q
+}
+
+// wake releases every ReceiveMessage waiting for messages. s.mu must be held.
+// FailNext makes the next times calls of operation, such as "ReceiveMessage",
+// fail as a whole with the error code, e.g. "InternalError". A negative times
+// fails every call until FailNext is called again.
+func (s *Server) FailNext(operation, code string, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if times == 0 {
+		delete(s.failures, operation)
+		return
+	}
+	s.failures[operation] = &failure{code: code, times: times}
+}
+
+// injected returns the error configured by FailNext for op, if any.
+func (s *Server) injected(op string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.failures[op]
+	if !ok {
+		return nil
+	}
+	if f.times > 0 {
+		if f.times--; f.times == 0 {
+			delete(s.failures, op)
+		}
+	}
+	return errorf(f.code, "injected failure")
+}
+
+func (s *Server) wake() {
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// apiError is returned to the client in the JSON protocol error format.
+type apiError struct {
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string { return e.code + ": " + e.message }
+
+func errorf(code, format string, args ...any) *apiError {
+	return &apiError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+type handler func(s *Server, r *http.Request, body []byte) (any, error)
+
+var operations = map[string]handler{
+	"CreateQueue":             (*Server).handleCreateQueue,
+	"GetQueueUrl":             (*Server).handleGetQueueURL,
+	"GetQueueAttributes":      (*Server).handleGetQueueAttributes,
+	"SendMessage":             (*Server).handleSendMessage,
+	"SendMessageBatch":        (*Server).handleSendMessageBatch,
+	"ReceiveMessage":          (*Server).handleReceiveMessage,
+	"DeleteMessage":           (*Server).handleDeleteMessage,
+	"DeleteMessageBatch":      (*Server).handleDeleteMessageBatch,
+	"ChangeMessageVisibility": (*Server).handleChangeMessageVisibility,
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.")
+	var out any
+	var err error
+	if h, ok := operations[op]; ok {
+		var body []byte
+		body, err = readBody(r)
+		if err == nil {
+			err = s.injected(op)
+		}
+		if err == nil {
+			out, err = h(s, r, body)
+		}
+	} else {
+		err = errorf("UnsupportedOperation", "operation %q is not supported", op)
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.Header().Set("X-Amzn-RequestId", uuid.NewString())
+	if err != nil {
+		apiErr, ok := err.(*apiError)
+		if !ok {
+			apiErr = errorf("InvalidParameterValue", "%v", err)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"__type":  "com.amazonaws.sqs#" + apiErr.code,
+			"message": apiErr.message,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return []byte("{}"), nil
+	}
+	return body, nil
+}
+
+// lookup returns the queue addressed by url. s.mu must be held.
+func (s *Server) lookup(url string) (*queue, error) {
+	name := url[strings.LastIndex(url, "/")+1:]
+	q, ok := s.queues[name]
+	if !ok || url == "" {
+		return nil, errorf("QueueDoesNotExist", "The specified queue does not exist.")
+	}
+	return q, nil
+}
+
+func (s *Server) handleCreateQueue(_ *http.Request, body []byte) (any, error) {
+	var in struct {
+		QueueName  string
+		Attributes map[string]string
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	if in.QueueName == "" {
+		return nil, errorf("InvalidParameterValue", "QueueName is required")
+	}
+	return map[string]string{"QueueUrl": s.CreateQueue(in.QueueName, in.Attributes)}, nil
+}
+
+func (s *Server) handleGetQueueURL(_ *http.Request, body []byte) (any, error) {
+	var in struct{ QueueName string }
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.queues[in.QueueName]; !ok {
+		return nil, errorf("QueueDoesNotExist", "The specified queue does not exist.")
+	}
+	return map[string]string{"QueueUrl": s.QueueURL(in.QueueName)}, nil
+}
+
+func (s *Server) handleGetQueueAttributes(_ *http.Request, body []byte) (any, error) {
+	var in struct{ QueueUrl string }
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.lookup(in.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var visible, inFlight, delayed int
+	for _, m := range q.messages {
+		switch {
+		case !m.visibleAt.After(now):
+			visible++
+		case m.receiveCount > 0:
+			inFlight++
+		default:
+			delayed++
+		}
+	}
+	attributes := map[string]string{
+		"ApproximateNumberOfMessages":           strconv.Itoa(visible),
+		"ApproximateNumberOfMessagesNotVisible": strconv.Itoa(inFlight),
+		"ApproximateNumberOfMessagesDelayed":    strconv.Itoa(delayed),
+		"VisibilityTimeout":                     strconv.Itoa(int(q.visibility() / time.Second)),
+	}
+	for k, v := range q.attributes {
+		attributes[k] = v
+	}
+	return map[string]any{"Attributes": attributes}, nil
+}
+
+func (q *queue) visibility() time.Duration {
+	if v, err := strconv.Atoi(q.attributes["VisibilityTimeout"]); err == nil {
+		return time.Duration(v) * time.Second
+	}
+	return defaultVisibility
+}
+
+func (q *queue) fifo() bool {
+	return q.attributes["FifoQueue"] == "true"
+}
+
+type sendEntry struct {
+	Id                     string
+	MessageBody            string
+	DelaySeconds           int
+	MessageAttributes      map[string]json.RawMessage
+	MessageGroupId         string
+	MessageDeduplicationId string
+}
+
+type sendResult struct {
+	Id               string `json:",omitempty"`
+	MessageId        string
+	MD5OfMessageBody string
+}
+
+// send stores e in q and returns its message ID. s.mu must be held.
+func (s *Server) send(q *queue, e sendEntry) (string, error) {
+	if e.MessageBody == "" {
+		return "", errorf("MissingParameter", "The request must contain the parameter MessageBody.")
+	}
+	if q.fifo() {
+		if e.MessageGroupId == "" {
+			return "", errorf("MissingParameter", "The request must contain the parameter MessageGroupId.")
+		}
+		if e.MessageDeduplicationId == "" {
+			return "", errorf("InvalidParameterValue", "The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+		}
+	}
+
+	now := time.Now()
+	m := &message{
+		id:         uuid.NewString(),
+		body:       e.MessageBody,
+		attributes: e.MessageAttributes,
+		groupID:    e.MessageGroupId,
+		sentAt:     now,
+		visibleAt:  now.Add(time.Duration(e.DelaySeconds) * time.Second),
+	}
+	if q.fifo() {
+		if sent, ok := q.dedup[e.MessageDeduplicationId]; ok && now.Sub(sent) < dedupWindow {
+			return m.id, nil
+		}
+		q.dedup[e.MessageDeduplicationId] = now
+	}
+	q.messages = append(q.messages, m)
+	s.wake()
+	return m.id, nil
+}
+
+func (s *Server) handleSendMessage(_ *http.Request, body []byte) (any, error) {
+	var in struct {
+		QueueUrl string
+		sendEntry
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.lookup(in.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.send(q, in.sendEntry)
+	if err != nil {
+		return nil, err
+	}
+	return sendResult{MessageId: id, MD5OfMessageBody: md5Hex(in.MessageBody)}, nil
+}
+
+type batchFailure struct {
+	Id          string
+	Code        string
+	Message     string
+	SenderFault bool
+}
+
+func (s *Server) handleSendMessageBatch(_ *http.Request, body []byte) (any, error) {
+	var in struct {
+		QueueUrl string
+		Entries  []sendEntry
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	if len(in.Entries) == 0 {
+		return nil, errorf("EmptyBatchRequest", "There should be at least one SendMessageBatchRequestEntry in the request.")
+	}
+	if len(in.Entries) > 10 {
+		return nil, errorf("TooManyEntriesInBatchRequest", "Maximum number of entries per request are 10.")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.lookup(in.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	successful := []sendResult{}
+	failed := []batchFailure{}
+	for _, e := range in.Entries {
+		id, err := s.send(q, e)
+		if err != nil {
+			apiErr := err.(*apiError)
+			failed = append(failed, batchFailure{Id: e.Id, Code: apiErr.code, Message: apiErr.message, SenderFault: true})
+			continue
+		}
+		successful = append(successful, sendResult{Id: e.Id, MessageId: id, MD5OfMessageBody: md5Hex(e.MessageBody)})
+	}
+	return map[string]any{"Successful": successful, "Failed": failed}, nil
+}
+
+type receivedMessage struct {
+	MessageId         string
+	ReceiptHandle     string
+	MD5OfBody         string
+	Body              string
+	Attributes        map[string]string          `json:",omitempty"`
+	MessageAttributes map[string]json.RawMessage `json:",omitempty"`
+}
+
+func (s *Server) handleReceiveMessage(r *http.Request, body []byte) (any, error) {
+	var in struct {
+		QueueUrl                    string
+		MaxNumberOfMessages         int
+		WaitTimeSeconds             int
+		VisibilityTimeout           *int
+		AttributeNames              []string
+		MessageSystemAttributeNames []string
+		MessageAttributeNames       []string
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	if in.MaxNumberOfMessages == 0 {
+		in.MaxNumberOfMessages = 1
+	}
+	if in.MaxNumberOfMessages < 1 || in.MaxNumberOfMessages > 10 {
+		return nil, errorf("InvalidParameterValue", "Value %d for parameter MaxNumberOfMessages is invalid.", in.MaxNumberOfMessages)
+	}
+	systemAttributes := append(in.AttributeNames, in.MessageSystemAttributeNames...)
+
+	deadline := time.Now().Add(time.Duration(in.WaitTimeSeconds) * time.Second)
+	for {
+		s.mu.Lock()
+		q, err := s.lookup(in.QueueUrl)
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		visibility := q.visibility()
+		if in.VisibilityTimeout != nil {
+			visibility = time.Duration(*in.VisibilityTimeout) * time.Second
+		}
+		received := s.receive(q, in.MaxNumberOfMessages, visibility)
+		notify := s.notify
+		s.mu.Unlock()
+
+		if len(received) > 0 || !time.Now().Before(deadline) {
+			out := make([]receivedMessage, len(received))
+			for i, m := range received {
+				out[i] = m.output(systemAttributes, in.MessageAttributeNames)
+			}
+			return map[string]any{"Messages": out}, nil
+		}
+
+		// Delayed and in-flight messages become visible without a send, so
+		// wake up periodically as well.
+		select {
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-notify:
+		case <-time.After(min(100*time.Millisecond, time.Until(deadline))):
+		}
+	}
+}
+
+// receive marks up to max visible messages of q as in flight and returns
+// copies of them. On FIFO queues a group with a message in flight is skipped
+// so order within the group is preserved; like SQS, a single receive may
+// return several messages of the same group, in order. s.mu must be held.
+func (s *Server) receive(q *queue, max int, visibility time.Duration) []message {
+	now := time.Now()
+	maxReceives, dlq := s.redrive(q)
+	busy := make(map[string]bool)
+	var received []message
+	kept := q.messages[:0]
+	for _, m := range q.messages {
+		if len(received) == max {
+			kept = append(kept, m)
+			continue
+		}
+		if m.visibleAt.After(now) {
+			if m.receiveCount > 0 && q.fifo() {
+				busy[m.groupID] = true
+			}
+			kept = append(kept, m)
+			continue
+		}
+		if q.fifo() && busy[m.groupID] {
+			kept = append(kept, m)
+			continue
+		}
+		if dlq != nil && m.receiveCount >= maxReceives {
+			m.sourceARN = QueueARN(q.name)
+			dlq.messages = append(dlq.messages, m)
+			continue
+		}
+
+		m.receiveCount++
+		if m.firstReceive.IsZero() {
+			m.firstReceive = now
+		}
+		m.visibleAt = now.Add(visibility)
+		m.receiptHandle = uuid.NewString()
+		received = append(received, *m)
+		kept = append(kept, m)
+	}
+	clear(q.messages[len(kept):])
+	q.messages = kept
+	return received
+}
+
+// redrive returns the dead-letter queue configured in the RedrivePolicy of q,
+// if any, and its maxReceiveCount. s.mu must be held.
+func (s *Server) redrive(q *queue) (int, *queue) {
+	raw, ok := q.attributes["RedrivePolicy"]
+	if !ok {
+		return 0, nil
+	}
+	var policy struct {
+		DeadLetterTargetArn string          `json:"deadLetterTargetArn"`
+		MaxReceiveCount     json.RawMessage `json:"maxReceiveCount"`
+	}
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		return 0, nil
+	}
+	maxReceives, err := strconv.Atoi(strings.Trim(string(policy.MaxReceiveCount), `"`))
+	if err != nil || maxReceives <= 0 {
+		return 0, nil
+	}
+	name := policy.DeadLetterTargetArn[strings.LastIndex(policy.DeadLetterTargetArn, ":")+1:]
+	dlq, ok := s.queues[name]
+	if !ok {
+		return 0, nil
+	}
+	return maxReceives, dlq
+}
+
+func (m message) output(systemAttributes, messageAttributes []string) receivedMessage {
+	out := receivedMessage{
+		MessageId:     m.id,
+		ReceiptHandle: m.receiptHandle,
+		MD5OfBody:     md5Hex(m.body),
+		Body:          m.body,
+	}
+	if len(systemAttributes) > 0 {
+		all := map[string]string{
+			"SentTimestamp":                    strconv.FormatInt(m.sentAt.UnixMilli(), 10),
+			"ApproximateReceiveCount":          strconv.Itoa(m.receiveCount),
+			"ApproximateFirstReceiveTimestamp": strconv.FormatInt(m.firstReceive.UnixMilli(), 10),
+		}
+		if m.groupID != "" {
+			all["MessageGroupId"] = m.groupID
+		}
+		if m.sourceARN != "" {
+			all["DeadLetterQueueSourceArn"] = m.sourceARN
+		}
+		out.Attributes = make(map[string]string)
+		for _, name := range systemAttributes {
+			if name == "All" {
+				out.Attributes = all
+				break
+			}
+			if v, ok := all[name]; ok {
+				out.Attributes[name] = v
+			}
+		}
+	}
+	if len(messageAttributes) > 0 && len(m.attributes) > 0 {
+		out.MessageAttributes = make(map[string]json.RawMessage)
+		for name, v := range m.attributes {
+			for _, want := range messageAttributes {
+				if want == "All" || want == ".*" || want == name ||
+					(strings.HasSuffix(want, ".*") && strings.HasPrefix(name, strings.TrimSuffix(want, "*"))) {
+					out.MessageAttributes[name] = v
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// remove deletes the message holding receiptHandle from q. s.mu must be held.
+func (q *queue) remove(receiptHandle string) error {
+	for i, m := range q.messages {
+		if m.receiptHandle != "" && m.receiptHandle == receiptHandle {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			return nil
+		}
+	}
+	return errorf("ReceiptHandleIsInvalid", "The input receipt handle %q is not a valid receipt handle.", receiptHandle)
+}
+
+func (s *Server) handleDeleteMessage(_ *http.Request, body []byte) (any, error) {
+	var in struct {
+		QueueUrl      string
+		ReceiptHandle string
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.lookup(in.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.remove(in.ReceiptHandle); err != nil {
+		return nil, err
+	}
+	s.wake()
+	return struct{}{}, nil
+}
+
+func (s *Server) handleDeleteMessageBatch(_ *http.Request, body []byte) (any, error) {
+	var in struct {
+		QueueUrl string
+		Entries  []struct {
+			Id            string
+			ReceiptHandle string
+		}
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	if len(in.Entries) == 0 {
+		return nil, errorf("EmptyBatchRequest", "There should be at least one DeleteMessageBatchRequestEntry in the request.")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.lookup(in.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct{ Id string }
+	successful := []result{}
+	failed := []batchFailure{}
+	for _, e := range in.Entries {
+		if err := q.remove(e.ReceiptHandle); err != nil {
+			apiErr := err.(*apiError)
+			failed = append(failed, batchFailure{Id: e.Id, Code: apiErr.code, Message: apiErr.message, SenderFault: true})
+			continue
+		}
+		successful = append(successful, result{Id: e.Id})
+	}
+	s.wake()
+	return map[string]any{"Successful": successful, "Failed": failed}, nil
+}
+
+func (s *Server) handleChangeMessageVisibility(_ *http.Request, body []byte) (any, error) {
+	var in struct {
+		QueueUrl          string
+		ReceiptHandle     string
+		VisibilityTimeout int
+	}
+	if err := json.Unmarshal(body, &in); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, err := s.lookup(in.QueueUrl)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range q.messages {
+		if m.receiptHandle != "" && m.receiptHandle == in.ReceiptHandle {
+			m.visibleAt = time.Now().Add(time.Duration(in.VisibilityTimeout) * time.Second)
+			s.wake()
+			return struct{}{}, nil
+		}
+	}
+	return nil, errorf("ReceiptHandleIsInvalid", "The input receipt handle %q is not a valid receipt handle.", in.ReceiptHandle)
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -36,6 +36,25 @@ func (m *MinIOStorage) Upload(ctx context.Context, bucket, key string, file io.R
 	return nil
 }
 
+func (m *MinIOStorage) Download(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	obj, err := m.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object: %w", err)
+	}
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("failed to download object: %w", err)
+	}
+	return obj, nil
+}
+
+func (m *MinIOStorage) Delete(ctx context.Context, bucket, key string) error {
+	if err := m.client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
 func (m *MinIOStorage) GetPresignedURL(ctx context.Context, bucket, key string, expiry time.Duration) (string, error) {
 	reqParams := make(map[string][]string)
 	url, err := m.client.PresignedGetObject(ctx, bucket, key, expiry, reqParams)
@@ -44,3 +63,11 @@ func (m *MinIOStorage) GetPresignedURL(ctx context.Context, bucket, key string,
 	}
 	return url.String(), nil
 }
+
+func (m *MinIOStorage) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	exists, err := m.client.BucketExists(ctx, bucket)
+	if err != nil {
+		return false, fmt.Errorf("failed to check bucket: %w", err)
+	}
+	return exists, nil
+}
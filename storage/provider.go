@@ -10,3 +10,11 @@ type StorageProvider interface {
 	Upload(context.Context, string, string, io.Reader, string) error
 	GetPresignedURL(context.Context, string, string, time.Duration) (string, error)
 }
+
+// PayloadStore is a StorageProvider that can also read objects back and
+// remove them, such as S3Storage and MinIOStorage.
+type PayloadStore interface {
+	StorageProvider
+	Download(context.Context, string, string) (io.ReadCloser, error)
+	Delete(context.Context, string, string) error
+}
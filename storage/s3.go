@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type S3Storage struct {
@@ -47,6 +49,28 @@ func (s *S3Storage) Upload(ctx context.Context, bucket, key string, file io.Read
 	return nil
 }
 
+func (s *S3Storage) Download(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	out, err := s.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from s3: %w", err)
+	}
+	return out.Body, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, bucket, key string) error {
+	_, err := s.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete from s3: %w", err)
+	}
+	return nil
+}
+
 func (s *S3Storage) GetPresignedURL(ctx context.Context, bucket, key string, expiry time.Duration) (string, error) {
 	presigner := s3.NewPresignClient(s.Client)
 	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
@@ -58,3 +82,15 @@ func (s *S3Storage) GetPresignedURL(ctx context.Context, bucket, key string, exp
 	}
 	return req.URL, nil
 }
+
+func (s *S3Storage) BucketExists(ctx context.Context, bucket string) (bool, error) {
+	_, err := s.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check s3 bucket: %w", err)
+	}
+	return true, nil
+}